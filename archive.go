@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"golang.org/x/term"
+)
+
+// save writes an image, with the tag it is named by if any, to a tarball.
+func save(image string, file string, opts allOpts) {
+	client := newClient()
+	img, err := client.InspectImage(image)
+	if err != nil {
+		if errors.Is(err, docker.ErrNoSuchImage) {
+			failf("Found no image matching: %s", image)
+		}
+		fatalf("InspectImage: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "Found image: %s %s\n", shortID(img.ID), strings.Join(img.RepoTags, ","))
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if opts.archiveForce {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(file, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		failf("%s exists, use --force to overwrite it.", file)
+	} else if err != nil {
+		failf("%s", err)
+	}
+
+	out := &progress{w: f}
+	stop := out.report("written")
+	err = client.ExportImage(docker.ExportImageOptions{Name: image, OutputStream: out})
+	stop()
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		os.Remove(file)
+		fatalf("ExportImage: %s", err)
+	}
+	fmt.Printf("Saved %s to %s\n", prettySize(out.n), file)
+}
+
+// load reads images from a tarball made by save (or docker save).
+func load(file string) {
+	client := newClient()
+	f, err := os.Open(file)
+	if err != nil {
+		failf("%s", err)
+	}
+	defer f.Close()
+
+	in := &progress{r: f}
+	stop := in.report("read")
+	var messages bytes.Buffer
+	err = client.LoadImage(docker.LoadImageOptions{InputStream: in, OutputStream: &messages})
+	stop()
+	if err != nil {
+		fatalf("LoadImage: %s", err)
+	}
+
+	// The daemon tells what it loaded as a JSON stream
+	dec := json.NewDecoder(&messages)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			fatalf("LoadImage: %s", err)
+		}
+		if msg.Error != "" {
+			fatalf("LoadImage: %s", msg.Error)
+		}
+		if line := strings.TrimSpace(msg.Stream); line != "" {
+			fmt.Println(line)
+		}
+	}
+}
+
+// progress counts the bytes passing through it, to a writer or from a reader.
+type progress struct {
+	w io.Writer
+	r io.Reader
+	n int64
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	atomic.AddInt64(&p.n, int64(n))
+	return n, err
+}
+
+func (p *progress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	atomic.AddInt64(&p.n, int64(n))
+	return n, err
+}
+
+// report shows the byte count on stderr every half second, if it is a
+// terminal, until the returned func is called.
+func (p *progress) report(verb string) func() {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return func() {}
+	}
+	done := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		defer close(finished)
+		tick := time.NewTicker(500 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				fmt.Fprintf(os.Stderr, "\r\x1b[K")
+				return
+			case <-tick.C:
+				fmt.Fprintf(os.Stderr, "\r\x1b[K%s %s", prettySize(atomic.LoadInt64(&p.n)), verb)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// inspectCache keeps what ps inspected, for ps --cache to reuse for a
+// little while. Containers are still listed every time, so that removed
+// ones drop out and new ones are inspected.
+type inspectCache struct {
+	Saved        time.Time                    `json:"saved"`
+	Containers   map[string]*docker.Container `json:"containers"`
+	ImageCreated map[string]time.Time         `json:"imageCreated"`
+}
+
+// cacheFile is where the cache of an endpoint is kept, in the user's cache
+// dir (like ~/.cache/dx), which others cannot write to, unlike the temp dir.
+func cacheFile(endpoint string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(endpoint))
+	return filepath.Join(dir, "dx", fmt.Sprintf("ps-%x.json", sum[:6])), nil
+}
+
+// loadCache returns the cache of endpoint if it is younger than maxAge, or
+// else an empty one. A missing or broken cache file is as good as stale, and
+// so is one saved in the future, as by a clock that was off.
+func loadCache(endpoint string, maxAge time.Duration) *inspectCache {
+	cache := &inspectCache{}
+	file, err := cacheFile(endpoint)
+	if err == nil {
+		var b []byte
+		if b, err = os.ReadFile(file); err == nil {
+			err = json.Unmarshal(b, cache)
+		}
+	}
+	if err != nil || time.Since(cache.Saved) > maxAge || cache.Saved.After(time.Now()) {
+		cache = &inspectCache{}
+	}
+	if cache.Containers == nil {
+		cache.Containers = map[string]*docker.Container{}
+		cache.ImageCreated = map[string]time.Time{}
+	}
+	return cache
+}
+
+// save writes the cache. The time of a cache that was loaded fresh is left
+// alone, so that it still expires maxAge after the first inspection.
+func (cache *inspectCache) save(endpoint string) {
+	if cache.Saved.IsZero() {
+		cache.Saved = time.Now()
+	}
+	b, err := json.Marshal(cache)
+	if err != nil {
+		fatalf("Marshal: %s", err)
+	}
+	if err := writeCache(endpoint, b); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing cache: %s\n", err)
+	}
+}
+
+// writeCache replaces the cache file of endpoint with b, through a new
+// temporary file, so that a concurrent ps never reads half of it.
+func writeCache(endpoint string, b []byte) error {
+	file, err := cacheFile(endpoint)
+	if err != nil {
+		return err
+	}
+	// Inspect output has the environment, which can hold secrets
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// composeFiles are the files docker compose looks for, in its order.
+var composeFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// composeProject returns the compose project of the current directory, as
+// docker compose would name it, and the compose file it found; or "" if
+// there is none. The name is $COMPOSE_PROJECT_NAME, the top-level name in the
+// compose file, or else the directory's name, normalized.
+func composeProject() (string, string) {
+	file := ""
+	for _, f := range composeFiles {
+		if _, err := os.Stat(f); err == nil {
+			file = f
+			break
+		}
+	}
+	if file == "" {
+		return "", ""
+	}
+	if name := os.Getenv("COMPOSE_PROJECT_NAME"); name != "" {
+		return name, file
+	}
+	if name := composeName(file); name != "" {
+		return name, file
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", ""
+	}
+	name := strings.ToLower(filepath.Base(dir))
+	return regexp.MustCompile(`[^a-z0-9_-]`).ReplaceAllString(name, ""), file
+}
+
+// composeName reads the top-level name: of a compose file, without parsing
+// the YAML proper.
+func composeName(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "name:") {
+			continue
+		}
+		name := strings.TrimSpace(strings.TrimPrefix(line, "name:"))
+		if i := strings.Index(name, " #"); i >= 0 {
+			name = strings.TrimSpace(name[:i])
+		}
+		return strings.Trim(name, `"'`)
+	}
+	return ""
+}
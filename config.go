@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// dxConfig holds the user's settings, read from config.json in configDir.
+type dxConfig struct {
+	// Headers relabels table columns, by column key (like "id", "up", or
+	// "imageAge")
+	Headers map[string]string `json:"headers"`
+	// HideInfra makes ps --hide-infra the default
+	HideInfra bool `json:"hideInfra"`
+	// InfraImages and InfraLabels extend infraImages and infraLabels
+	InfraImages []string `json:"infraImages"`
+	InfraLabels []string `json:"infraLabels"`
+	// Endpoints are aliases for docker endpoints, for --host and --hosts
+	Endpoints map[string]string `json:"endpoints"`
+	// SecretEnv extends secretEnv
+	SecretEnv []string `json:"secretEnv"`
+}
+
+var config dxConfig
+
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "dx")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".dx"
+	}
+	return filepath.Join(home, ".config", "dx")
+}
+
+// loadConfig reads the config file, if there is one.
+func loadConfig() (dxConfig, error) {
+	c := dxConfig{}
+	path := filepath.Join(configDir(), "config.json")
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// headerCase is the --header-case applied to column headers, if any.
+var headerCase = ""
+
+func setHeaderCase(c string) {
+	switch c {
+	case "", "upper", "lower", "title":
+		headerCase = c
+	default:
+		fmt.Printf("%q: unknown header case.\n", c)
+		os.Exit(2)
+	}
+}
+
+// heading returns the header of the column key, labelled as configured or
+// else label, in the --header-case.
+func heading(key string, label string) string {
+	if l, ok := config.Headers[key]; ok {
+		label = l
+	}
+	switch headerCase {
+	case "upper":
+		return strings.ToUpper(label)
+	case "lower":
+		return strings.ToLower(label)
+	case "title":
+		words := strings.Fields(label)
+		for i, w := range words {
+			r := []rune(w)
+			r[0] = unicode.ToUpper(r[0])
+			words[i] = string(r)
+		}
+		return strings.Join(words, " ")
+	}
+	return label
+}
+
+// endpointFor resolves an endpoint alias. Anything with a scheme (like
+// tcp://) is an endpoint already.
+func endpointFor(name string) (string, error) {
+	if strings.Contains(name, "://") {
+		return name, nil
+	}
+	if endpoint, ok := config.Endpoints[name]; ok {
+		return endpoint, nil
+	}
+	known := []string{}
+	for alias := range config.Endpoints {
+		known = append(known, alias)
+	}
+	sort.Strings(known)
+	return "", fmt.Errorf("%q: unknown endpoint alias; known: %s", name, strings.Join(known, ", "))
+}
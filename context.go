@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const defaultEndpoint = "unix:///var/run/docker.sock"
+
+// dockerContext is the part of a docker context's meta.json that we use.
+type dockerContext struct {
+	Name      string
+	Endpoints struct {
+		Docker struct {
+			Host string
+		} `json:"docker"`
+	}
+}
+
+func contextLs() {
+	contexts, err := listContexts()
+	if err != nil {
+		failf("Reading contexts: %s", err)
+	}
+	current := currentContext()
+
+	lines := [][]string{}
+	for _, c := range contexts {
+		name := c.Name
+		if name == current {
+			name += "*"
+		}
+		lines = append(lines, []string{name, c.Endpoints.Docker.Host})
+	}
+	writeTable([]column{{key: "name", label: "name"}, {key: "endpoint", label: "endpoint"}}, lines)
+}
+
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".docker"
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// currentContext returns the name of the context selected by DOCKER_CONTEXT
+// or else by currentContext in the docker config.
+func currentContext() string {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name
+	}
+	b, err := os.ReadFile(filepath.Join(dockerConfigDir(), "config.json"))
+	if err != nil {
+		return "default"
+	}
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil || config.CurrentContext == "" {
+		return "default"
+	}
+	return config.CurrentContext
+}
+
+// listContexts reads the context store, returning the contexts sorted by
+// name, preceded by the implicit default context.
+func listContexts() ([]dockerContext, error) {
+	def := dockerContext{Name: "default"}
+	def.Endpoints.Docker.Host = defaultEndpoint
+	if dockerhost := os.Getenv("DOCKER_HOST"); dockerhost != "" {
+		def.Endpoints.Docker.Host = dockerhost
+	}
+
+	metas, err := filepath.Glob(filepath.Join(dockerConfigDir(), "contexts", "meta", "*", "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+	contexts := []dockerContext{}
+	for _, meta := range metas {
+		c, err := readContext(meta)
+		if err != nil {
+			return nil, err
+		}
+		contexts = append(contexts, *c)
+	}
+	sort.Slice(contexts, func(i, j int) bool {
+		return contexts[i].Name < contexts[j].Name
+	})
+	return append([]dockerContext{def}, contexts...), nil
+}
+
+func readContext(meta string) (*dockerContext, error) {
+	b, err := os.ReadFile(meta)
+	if err != nil {
+		return nil, err
+	}
+	var c dockerContext
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", meta, err)
+	}
+	return &c, nil
+}
+
+// contextEndpoint returns the docker endpoint of the named context. The
+// context store keeps each context in a directory named by the SHA-256 of
+// its name.
+func contextEndpoint(name string) (string, error) {
+	sum := sha256.Sum256([]byte(name))
+	meta := filepath.Join(dockerConfigDir(), "contexts", "meta", hex.EncodeToString(sum[:]), "meta.json")
+	c, err := readContext(meta)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("context %q not found", name)
+		}
+		return "", err
+	}
+	return c.Endpoints.Docker.Host, nil
+}
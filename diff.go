@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func diff(arg string, opts allOpts) {
+	client := newClient()
+	c, err := resolveContainer(client, arg)
+	if err != nil {
+		failf("%s", err)
+	}
+	fmt.Fprintf(os.Stderr, "Found container: %s %s\n", c.ID[:6], containerName(c))
+
+	changes, err := client.ContainerChanges(c.ID)
+	if err != nil {
+		fatalf("ContainerChanges: %s", err)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	// Without any kind asked for, show all
+	kinds := map[docker.ChangeType]bool{
+		docker.ChangeAdd:    opts.diffAdded,
+		docker.ChangeModify: opts.diffModified,
+		docker.ChangeDelete: opts.diffDeleted,
+	}
+	all := !opts.diffAdded && !opts.diffModified && !opts.diffDeleted
+	prefix := strings.TrimSuffix(opts.diffPath, "/")
+	counts := map[docker.ChangeType]int{}
+	for _, change := range changes {
+		if !all && !kinds[change.Kind] {
+			continue
+		}
+		if prefix != "" && change.Path != prefix && !strings.HasPrefix(change.Path, prefix+"/") {
+			continue
+		}
+		counts[change.Kind]++
+		fmt.Println(changeLine(change))
+	}
+	fmt.Printf("\nadded: %d, changed: %d, deleted: %d\n",
+		counts[docker.ChangeAdd], counts[docker.ChangeModify], counts[docker.ChangeDelete])
+}
+
+func changeLine(change docker.Change) string {
+	switch change.Kind {
+	case docker.ChangeAdd:
+		return colorize("A "+change.Path, green)
+	case docker.ChangeModify:
+		return colorize("C "+change.Path, yellow)
+	case docker.ChangeDelete:
+		return colorize("D "+change.Path, red)
+	}
+	return "? " + change.Path
+}
+
+// snapshot compares obj with the one saved at --diff, and saves it to --save.
+func snapshot(obj interface{}, opts allOpts) {
+	b, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		fatalf("Marshal: %s", err)
+	}
+	if opts.xDiff != "" {
+		saved, err := os.ReadFile(opts.xDiff)
+		if err != nil {
+			failf("%s", err)
+		}
+		// Compare as generic JSON, so that any field of the inspect
+		// struct is covered
+		var before, after interface{}
+		if err := json.Unmarshal(saved, &before); err != nil {
+			failf("%s: %s", opts.xDiff, err)
+		}
+		if err := json.Unmarshal(b, &after); err != nil {
+			fatalf("Unmarshal: %s", err)
+		}
+		for _, line := range jsonDiff("", before, after) {
+			fmt.Println(line)
+		}
+	}
+	if opts.xSave != "" {
+		if err := os.WriteFile(opts.xSave, append(b, '\n'), 0o644); err != nil {
+			failf("%s", err)
+		}
+	}
+}
+
+// jsonDiff lists the fields below path that were added, removed, or changed
+// from a to b, colored like changeLine.
+func jsonDiff(path string, a interface{}, b interface{}) []string {
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := []string{}
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		lines := []string{}
+		for _, k := range keys {
+			lines = append(lines, jsonDiffField(strings.TrimPrefix(path+"."+k, "."), am, bm, k)...)
+		}
+		return lines
+	}
+
+	as, aIsSlice := a.([]interface{})
+	bs, bIsSlice := b.([]interface{})
+	if aIsSlice && bIsSlice {
+		lines := []string{}
+		for i := 0; i < len(as) || i < len(bs); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(bs):
+				lines = append(lines, colorize("- "+p+": "+jsonValue(as[i]), red))
+			case i >= len(as):
+				lines = append(lines, colorize("+ "+p+": "+jsonValue(bs[i]), green))
+			default:
+				lines = append(lines, jsonDiff(p, as[i], bs[i])...)
+			}
+		}
+		return lines
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return []string{colorize("~ "+path+": "+jsonValue(a)+" → "+jsonValue(b), yellow)}
+}
+
+func jsonDiffField(path string, a map[string]interface{}, b map[string]interface{}, key string) []string {
+	av, inA := a[key]
+	bv, inB := b[key]
+	switch {
+	case !inB:
+		return []string{colorize("- "+path+": "+jsonValue(av), red)}
+	case !inA:
+		return []string{colorize("+ "+path+": "+jsonValue(bv), green)}
+	}
+	return jsonDiff(path, av, bv)
+}
+
+func jsonValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fatalf("Marshal: %s", err)
+	}
+	return string(b)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// errorFormat is how fatal errors are reported: text, or json for wrappers
+// to parse (--error-format).
+var errorFormat errorFormatValue = "text"
+
+type errorFormatValue string
+
+func (v *errorFormatValue) String() string {
+	return string(*v)
+}
+
+func (v *errorFormatValue) Set(s string) error {
+	if s != "text" && s != "json" {
+		return fmt.Errorf("%q: not text or json", s)
+	}
+	*v = errorFormatValue(s)
+	return nil
+}
+
+func (v *errorFormatValue) Type() string {
+	return "format"
+}
+
+// fatalf reports an unexpected failure, like of a Docker API call, and exits
+// with 1.
+func fatalf(format string, args ...interface{}) {
+	if errorFormat == "json" {
+		errorJSON(fmt.Sprintf(format, args...), 1)
+	}
+	log.Fatalf(format, args...)
+}
+
+// failf reports that what was asked for cannot be done, like when nothing
+// matches, and exits with 1.
+func failf(format string, args ...interface{}) {
+	if errorFormat == "json" {
+		errorJSON(fmt.Sprintf(format, args...), 1)
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+// reportf reports an error as failf does, but without exiting, for when
+// more is to be done before exiting with 1, like for the other arguments.
+func reportf(format string, args ...interface{}) {
+	if errorFormat == "json" {
+		writeErrorJSON(fmt.Sprintf(format, args...), 1)
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+func errorJSON(msg string, code int) {
+	writeErrorJSON(msg, code)
+	os.Exit(code)
+}
+
+func writeErrorJSON(msg string, code int) {
+	// Colors, like of highlightPrefix, are no use to parsers
+	json.NewEncoder(os.Stderr).Encode(struct {
+		Error string `json:"error"`
+		Code  int    `json:"code"`
+	}{escapes.ReplaceAllString(msg, ""), code})
+}
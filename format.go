@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+var templateFuncs = template.FuncMap{
+	"age": func(t time.Time) string {
+		_, human := age(t)
+		return human
+	},
+	"size": prettySize,
+	"join": strings.Join,
+}
+
+// parseFormat handles --format json, and table which is the default, or
+// markdown, leaving anything else to parseTemplate.
+func parseFormat(format string, file string) (bool, *template.Template) {
+	if format == "json" && file == "" {
+		return true, nil
+	}
+	if format == "table" && file == "" {
+		return false, nil
+	}
+	if format == "markdown" && file == "" {
+		tableStyle.markdown = true
+		useColor = false
+		return false, nil
+	}
+	return false, parseTemplate(format, file)
+}
+
+// parseTemplate parses the text/template given inline with --format, or read
+// from a file with --format @path or --template-file. It returns nil if no
+// template was asked for. The template is named after its file, so that
+// errors point at file and line.
+func parseTemplate(format string, file string) *template.Template {
+	if strings.HasPrefix(format, "@") {
+		file = format[1:]
+	}
+	name, text := "format", format
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Reading template: %s\n", err)
+			os.Exit(2)
+		}
+		name, text = file, string(b)
+	}
+	if text == "" {
+		return nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		fmt.Printf("Parsing template: %s\n", err)
+		os.Exit(2)
+	}
+	return tmpl
+}
+
+// outputJSON outputs the rows (a slice) as an indented JSON array, or if
+// compact, as one object per line.
+func outputJSON(rows interface{}, compact bool) {
+	if compact {
+		v := reflect.ValueOf(rows)
+		for i := 0; i < v.Len(); i++ {
+			b, err := json.Marshal(v.Index(i).Interface())
+			if err != nil {
+				fatalf("Marshal: %s", err)
+			}
+			fmt.Printf("%s\n", b)
+		}
+		return
+	}
+	b, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		fatalf("Marshal: %s", err)
+	}
+	fmt.Printf("%s\n", b)
+}
+
+// age returns the time since t in seconds and in human form; -1 and "?" if t
+// is unknown (zero).
+func age(t time.Time) (int64, string) {
+	if t.IsZero() {
+		return -1, "?"
+	}
+	d := time.Since(t)
+	return int64(d.Seconds()), prettyDuration(d)
+}
+
+// execTemplate outputs one row with tmpl, adding a newline unless the
+// template ends with one.
+func execTemplate(tmpl *template.Template, row interface{}) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, row); err != nil {
+		failf("Executing template: %s", err)
+	}
+	out := sb.String()
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	fmt.Print(out)
+}
+
+// tableStyle is how the table output is laid out, as passed to
+// tabwriter.Writer.Init.
+var tableStyle = struct {
+	minwidth int
+	tabwidth int
+	padding  int
+	padchar  string
+	bars     bool
+	markdown bool
+}{0, 2, 1, " ", false, false}
+
+func addTableFlags(flags *pflag.FlagSet) {
+	flags.IntVar(&tableStyle.minwidth, "table-minwidth", 0, "minimal width of table cells, including padding")
+	flags.IntVar(&tableStyle.tabwidth, "table-tabwidth", 2, "width of a tab, with --table-padchar '\\t'")
+	flags.IntVar(&tableStyle.padding, "table-padding", 1, "padding added to the width of table cells")
+	flags.StringVar(&tableStyle.padchar, "table-padchar", " ", "character to pad table cells with")
+	flags.BoolVar(&tableStyle.bars, "table-bars", false, "separate table columns with |")
+}
+
+// table is what the listing subcommands write their tab separated cells to,
+// a row per line, header first.
+type table interface {
+	io.Writer
+	Flush() error
+}
+
+func newTable(out io.Writer) table {
+	if tableStyle.markdown {
+		return &markdownTable{out: out}
+	}
+	padchar := tableStyle.padchar
+	if padchar == "\\t" {
+		padchar = "\t"
+	}
+	if len(padchar) != 1 {
+		fmt.Printf("%q: table padchar must be a single character.\n", tableStyle.padchar)
+		os.Exit(2)
+	}
+	var flags uint
+	if tableStyle.bars {
+		flags |= tabwriter.Debug
+	}
+	return tabwriter.NewWriter(out, tableStyle.minwidth, tableStyle.tabwidth,
+		tableStyle.padding, padchar[0], flags)
+}
+
+// column is a column of a table: the key that relabelled headers refer to,
+// its default heading, and whether its cells are right aligned, like numbers.
+type column struct {
+	key   string
+	label string
+	right bool
+}
+
+// writeTable writes rows of cells, one per column, as a table headed by the
+// columns' headings, in the --table style. The listing subcommands all
+// output through it. Empty cells at the end of a line are left out, so that
+// a last column that is mostly empty adds no padding.
+func writeTable(columns []column, rows [][]string) {
+	writeTableTo(os.Stdout, columns, rows)
+}
+
+func writeTableTo(out io.Writer, columns []column, rows [][]string) {
+	cells := make([][]string, len(columns)) // per column, heading first
+	for i, col := range columns {
+		cells[i] = []string{heading(col.key, col.label)}
+		for _, row := range rows {
+			cells[i] = append(cells[i], row[i])
+		}
+		if col.right {
+			cells[i] = alignRight(cells[i])
+		}
+		padInvisible(cells[i])
+	}
+	w := newTable(out)
+	for n := 0; n <= len(rows); n++ {
+		line := []string{}
+		for i := range columns {
+			line = append(line, cells[i][n])
+		}
+		for len(line) > 1 && line[len(line)-1] == "" {
+			line = line[:len(line)-1]
+		}
+		fmt.Fprintln(w, strings.Join(line, "\t"))
+	}
+	w.Flush()
+}
+
+// padInvisible pads cells with escape codes that do nothing, so that each
+// has as many bytes of them as the one with the most. The tabwriter counts
+// them as width, so otherwise cells with more colors, like the heading with
+// none, push the rest of their line right.
+func padInvisible(cells []string) {
+	invisible := make([]int, len(cells))
+	most := 0
+	for n, cell := range cells {
+		invisible[n] = len(cell) - len(escapes.ReplaceAllString(cell, ""))
+		if invisible[n] > most {
+			most = invisible[n]
+		}
+	}
+	// The shortest code that does nothing is 3 bytes
+	target := most
+	for _, n := range invisible {
+		if d := most - n; d == 1 || d == 2 {
+			target = most + 3
+		}
+	}
+	for n := range cells {
+		if d := target - invisible[n]; d > 0 {
+			cells[n] += "\x1b[" + strings.Repeat("0", d-3) + "m"
+		}
+	}
+}
+
+// markdownTable writes a GitHub flavored markdown table on Flush.
+type markdownTable struct {
+	out io.Writer
+	buf bytes.Buffer
+}
+
+func (t *markdownTable) Write(p []byte) (int, error) {
+	return t.buf.Write(p)
+}
+
+func (t *markdownTable) Flush() error {
+	lines := strings.Split(strings.TrimRight(t.buf.String(), "\n"), "\n")
+	for n, line := range lines {
+		cells := strings.Split(line, "\t")
+		for i := range cells {
+			cells[i] = strings.ReplaceAll(strings.TrimSpace(cells[i]), "|", `\|`)
+		}
+		fmt.Fprintf(t.out, "| %s |\n", strings.Join(cells, " | "))
+		if n == 0 {
+			underline := make([]string, len(cells))
+			for i := range underline {
+				underline[i] = "---"
+			}
+			fmt.Fprintf(t.out, "| %s |\n", strings.Join(underline, " | "))
+		}
+	}
+	t.buf.Reset()
+	return nil
+}
+
+// printPorcelain prints a line of --porcelain output: the fields separated by
+// tabs, with empty ones as "-". Tabs and newlines in fields become spaces,
+// and the "→" of ports becomes "->".
+func printPorcelain(fields ...string) {
+	for i, f := range fields {
+		f = strings.NewReplacer("\t", " ", "\n", " ", "→", "->").Replace(f)
+		if f == "" {
+			f = "-"
+		}
+		fields[i] = f
+	}
+	fmt.Println(strings.Join(fields, "\t"))
+}
+
+// porcelainTime formats t for --porcelain, in UTC; "-" if unknown.
+func porcelainTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
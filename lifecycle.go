@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+var signals = map[string]docker.Signal{
+	"SIGABRT":   docker.SIGABRT,
+	"SIGALRM":   docker.SIGALRM,
+	"SIGBUS":    docker.SIGBUS,
+	"SIGCHLD":   docker.SIGCHLD,
+	"SIGCONT":   docker.SIGCONT,
+	"SIGFPE":    docker.SIGFPE,
+	"SIGHUP":    docker.SIGHUP,
+	"SIGILL":    docker.SIGILL,
+	"SIGINT":    docker.SIGINT,
+	"SIGIO":     docker.SIGIO,
+	"SIGKILL":   docker.SIGKILL,
+	"SIGPIPE":   docker.SIGPIPE,
+	"SIGPROF":   docker.SIGPROF,
+	"SIGPWR":    docker.SIGPWR,
+	"SIGQUIT":   docker.SIGQUIT,
+	"SIGSEGV":   docker.SIGSEGV,
+	"SIGSTKFLT": docker.SIGSTKFLT,
+	"SIGSTOP":   docker.SIGSTOP,
+	"SIGSYS":    docker.SIGSYS,
+	"SIGTERM":   docker.SIGTERM,
+	"SIGTRAP":   docker.SIGTRAP,
+	"SIGTSTP":   docker.SIGTSTP,
+	"SIGTTIN":   docker.SIGTTIN,
+	"SIGTTOU":   docker.SIGTTOU,
+	"SIGURG":    docker.SIGURG,
+	"SIGUSR1":   docker.SIGUSR1,
+	"SIGUSR2":   docker.SIGUSR2,
+	"SIGVTALRM": docker.SIGVTALRM,
+	"SIGWINCH":  docker.SIGWINCH,
+	"SIGXCPU":   docker.SIGXCPU,
+	"SIGXFSZ":   docker.SIGXFSZ,
+}
+
+// parseSignal accepts signal names with or without the SIG prefix, in any
+// case.
+func parseSignal(name string) (string, docker.Signal, bool) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := signals[name]
+	return name, sig, ok
+}
+
+func kill(arg string, opts allOpts) {
+	name, sig, ok := parseSignal(opts.killSignal)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%q: unknown signal.\n", opts.killSignal)
+		os.Exit(2)
+	}
+	client := newClient()
+	c, err := resolveContainer(client, arg)
+	if err != nil {
+		failf("%s", err)
+	}
+	err = client.KillContainer(docker.KillContainerOptions{ID: c.ID, Signal: sig})
+	if err != nil {
+		fatalf("KillContainer: %s", err)
+	}
+	fmt.Printf("Sent %s to container: %s %s\n", name, c.ID[:6], containerName(c))
+}
+
+func pause(arg string) {
+	client := newClient()
+	c, err := resolveContainer(client, arg)
+	if err != nil {
+		failf("%s", err)
+	}
+	if err := client.PauseContainer(c.ID); err != nil {
+		fatalf("PauseContainer: %s", err)
+	}
+	fmt.Printf("Paused container: %s %s\n", c.ID[:6], containerName(c))
+}
+
+func unpause(arg string) {
+	client := newClient()
+	c, err := resolveContainer(client, arg)
+	if err != nil {
+		failf("%s", err)
+	}
+	if err := client.UnpauseContainer(c.ID); err != nil {
+		fatalf("UnpauseContainer: %s", err)
+	}
+	fmt.Printf("Unpaused container: %s %s\n", c.ID[:6], containerName(c))
+}
+
+// follow re-inspects a container every second, printing its state, health,
+// and IPs as they change, until it is running (and healthy, if it has a
+// health check).
+func follow(arg string) {
+	client := newClient()
+	c, err := resolveContainer(client, arg)
+	if err != nil {
+		failf("%s", err)
+	}
+	fmt.Fprintf(os.Stderr, "Found container: %s %s\n", c.ID[:6], containerName(c))
+
+	fields := []string{"state", "health", "ip"}
+	prev := map[string]string{}
+	for {
+		cinfo, err := client.InspectContainerWithOptions(
+			docker.InspectContainerOptions{ID: c.ID})
+		if err != nil {
+			if noSuchContainer(err) {
+				fmt.Printf("%s removed\n", time.Now().Format("15:04:05"))
+				failf("Container %s was removed.", c.ID[:6])
+			}
+			fatalf("InspectContainer: %s", err)
+		}
+		cur := map[string]string{
+			"state":  cinfo.State.Status,
+			"health": cinfo.State.Health.Status,
+			"ip":     "-",
+		}
+		if cinfo.NetworkSettings != nil {
+			if ips := ips(docker.NetworkList{Networks: cinfo.NetworkSettings.Networks}); len(ips) > 0 {
+				cur["ip"] = strings.Join(ips, ",")
+			}
+		}
+		for _, field := range fields {
+			if cur[field] != prev[field] {
+				fmt.Printf("%s %s: %s\n", time.Now().Format("15:04:05"), field, cur[field])
+			}
+		}
+		health := cinfo.State.Health.Status
+		if cinfo.State.Running && (health == "" || health == "healthy") {
+			return
+		}
+		prev = cur
+		time.Sleep(time.Second)
+	}
+}
@@ -1,20 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math"
 	"net"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"text/tabwriter"
+	"sync"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/spf13/pflag"
@@ -29,31 +35,214 @@ const (
 )
 
 type allOpts struct {
-	psAll     bool
-	psVerbose int
-	iAll      bool
+	psAll             bool
+	psVerbose         int
+	psFormat          string
+	psNetwork         string
+	psLogSize         bool
+	psHostname        bool
+	psAncestor        string
+	psOOM             bool
+	psShowProject     bool
+	psSort            string
+	psHosts           []string
+	psRestartPolicy   bool
+	psTree            bool
+	psBoot            bool
+	psInteractive     bool
+	psFailOnExited    bool
+	psHideInfra       bool
+	psIdle            bool
+	psIdleThreshold   float64
+	psPretty          bool
+	psUnhealthy       bool
+	psGroupBy         string
+	psCache           time.Duration
+	psColumns         []string
+	psTiming          bool
+	psLabelColumns    []string
+	psNoImageAge      bool
+	psWhere           string
+	psRestartedWithin time.Duration
+	psBindMounts      bool
+	psStrict          bool
+	psProject         string
+	psHighlight       string
+	psMissingFirst    bool
+	iAll              bool
+	iTree             bool
+	iDedupeLayers     bool
+	iDangling         bool
+	iLabels           []string
+	iMinSize          sizeValue
+	iMaxSize          sizeValue
+	iLastUsed         bool
+	iUntil            durationValue
+	vDriver           string
+	vLabels           []string
+	vOrphans          bool
+	vName             string
+	xOneline          bool
+	xCompact          bool
+	xRegex            bool
+	xDiff             string
+	xSave             string
+	xFollow           bool
+	xNet              bool
+	xRedact           bool
+
+	killSignal   string
+	diffAdded    bool
+	diffModified bool
+	diffDeleted  bool
+	diffPath     string
+	statsFollow  bool
+	statsRepeat  int
+	ageFormat    string
+	headerCase   string
+	wait         time.Duration
+	rawSize      bool
+	porcelain    bool
+	count        bool
+	host         string
+	idLength     int
+	hyperlinks   bool
+	archiveForce bool
+
+	// The --format of the listing subcommands: json, or a template
+	json        bool
+	jsonCompact bool
+	tmpl        *template.Template
+
+	// The parsed ps --where
+	where func(row psRow) bool
 }
 
 func main() {
+	var err error
+	if config, err = loadConfig(); err != nil {
+		failf("Reading config: %s", err)
+	}
+
 	opts := allOpts{}
 	psCmd := pflag.NewFlagSet("ps", pflag.ExitOnError)
 	psCmd.BoolVarP(&opts.psAll, "all", "a", false, "show all containers (not only running)")
 	psCmd.CountVarP(&opts.psVerbose, "verbose", "v",
 		fmt.Sprintf(`be more verbose, -v can be passed multiple times.
-1 time: add age of container, ports listening IP,
+1 time: add age of container, ports listening IP and
+ports only exposed (not published),
 cmd (always displayed if term width >= %d).
-2 times: also don't shorten anything.`, WIDE))
+2 times: also don't shorten anything.
+Defaults to $DX_VERBOSE if set.`, WIDE))
+	psCmd.StringVar(&opts.psFormat, "format", "",
+		fmt.Sprintf("use a preset layout (%s), overrides -v;\nor table (default), markdown, json, or a Go template, inline or from file with @path", strings.Join(psPresetNames(), ", ")))
+	addTableFlags(psCmd)
+	psTemplateFile := psCmd.String("template-file", "", "read Go template for output from file")
+	psCmd.StringVar(&opts.psNetwork, "network", "", "only show containers attached to network (name/ID prefix)")
+	psCmd.BoolVar(&opts.psLogSize, "log-size", false, "add size of the container's log file (json-file/local driver)")
+	psCmd.StringVar(&opts.psAncestor, "ancestor", "", "only show containers of image (name, name:tag, or ID prefix)")
+	psCmd.BoolVar(&opts.psOOM, "oom", false, "only show containers killed by the OOM killer (implies --all)")
+	psCmd.BoolVar(&opts.psShowProject, "show-project", false, "add compose project and service columns")
+	psCmd.StringVar(&opts.psSort, "sort", "created", "sort by created, name, project (then service, name), or image-age\n(newest image first); containers lacking the value go last")
+	psCmd.BoolVar(&opts.psMissingFirst, "missing-first", false, "with --sort, put containers lacking the value first instead")
+	psCmd.StringSliceVar(&opts.psHosts, "hosts", nil, "list containers of these docker endpoints or aliases (comma-separated),\nadding a host column")
+	psCmd.BoolVar(&opts.psRestartPolicy, "restart-policy", false, "add restart policy column")
+	psCmd.BoolVar(&opts.psTree, "tree", false, "nest containers under the container whose namespace (network, pid, ipc) they join")
+	psCmd.BoolVar(&opts.psBoot, "boot", false, "mark containers started before the host's last boot (local daemon only)")
+	psCmd.BoolVarP(&opts.psInteractive, "interactive", "i", false, "number the rows, then prompt for one to examine (or diff)")
+	psCmd.BoolVar(&opts.psFailOnExited, "fail-on-exited", false, "exit with 3 if any listed container failed: exited non-zero,\ndead, OOM killed, or restarting")
+	psCmd.BoolVar(&opts.psHideInfra, "hide-infra", config.HideInfra, "hide infrastructure containers, like kubernetes pause and kube-proxy")
+	psCmd.BoolVar(&opts.psIdle, "idle", false, "mark running containers using almost no CPU; sampling takes a moment")
+	psCmd.Float64Var(&opts.psIdleThreshold, "idle-threshold", 0.5, "CPU usage, in percent of one core, below which --idle marks a container")
+	psCmd.BoolVar(&opts.psPretty, "pretty", false, "print each container as a block of labelled lines, instead of a table")
+	psCmd.BoolVar(&opts.psUnhealthy, "unhealthy", false, "only show containers whose health check fails, or that are still\nstarting after the start period")
+	psCmd.StringVar(&opts.psGroupBy, "group-by", "", "group under a heading with count: image, or project")
+	psCmd.StringSliceVar(&opts.psColumns, "columns", nil, "show these columns, in this order (comma-separated), instead of\nthose of the layout: "+strings.Join(psColumnKeys, ","))
+	psCmd.StringArrayVar(&opts.psLabelColumns, "label-column", nil, "add a column of a label, as key=header or just key (repeatable)")
+	psCmd.DurationVar(&opts.psRestartedWithin, "restarted-within", 0, "only show containers that have restarted and last started within\nthis long (like 5m), marked with their restart count")
+	psCmd.BoolVar(&opts.psBindMounts, "bind-mounts", false, "only show containers with host bind mounts, adding a column of them\n(host:container, writable ones in red)")
+	psCmd.StringVarP(&opts.psProject, "project", "p", "", "only show containers of this compose project; for a table on the\nterminal of the local daemon, by default that of the compose file in\nthe current directory, if any (-p '' for all)")
+	psCmd.StringVar(&opts.psHighlight, "highlight", "", "underline cells containing this text, in any case, keeping all rows")
+	psCmd.BoolVar(&opts.psStrict, "strict", false, "fail if inspecting any container or image fails, instead of\nwarning and showing what the listing has")
+	psCmd.StringVar(&opts.psWhere, "where", "", "only show containers for which the expression holds, like\n'state==running && age>1d && image~nginx' (see README)")
+	psCmd.BoolVar(&opts.psNoImageAge, "no-image-age", false, "leave out the image age column, saving an image inspect per container")
+	psCmd.BoolVar(&opts.psTiming, "timing", false, "print to stderr how long listing and inspecting took")
+	psCmd.DurationVar(&opts.psCache, "cache", 0, "reuse what an earlier ps inspected if no older than this, like 5s")
+	psCmd.BoolVar(&opts.psHostname, "hostname", false, "add the hostname inside the container")
+	addListingFlags(psCmd, &opts, "containers", true)
+	psWide := psCmd.Bool("wide", false, "same as --format wide")
+	psCompact := psCmd.Bool("compact", false, "same as --format compact; with --format json,\none object per line")
 	iCmd := pflag.NewFlagSet("i", pflag.ExitOnError)
 	iCmd.BoolVarP(&opts.iAll, "all", "a", false, "show all images (including intermediate)")
+	iCmd.BoolVar(&opts.iTree, "tree", false, "nest images under their parent image (most useful with --all)")
+	iCmd.BoolVar(&opts.iDedupeLayers, "dedupe-layers", false, "add a footer comparing the sum of image sizes with the actual disk\nused by layers, shared layers counted once; not with filters")
+	iCmd.BoolVar(&opts.iDangling, "dangling", false, "only show untagged images that no tagged image builds on, with\na footer of the size reclaimable by docker image prune")
+	iCmd.StringArrayVar(&opts.iLabels, "label", nil, "only show images with label key or key=value (repeatable)")
+	iCmd.BoolVar(&opts.iLastUsed, "last-used", false, "add a column of when a container last used the image: running,\nthe age of the latest created container, or never")
+	iCmd.Var(&opts.iUntil, "until", "only show images created longer ago than this, like 168h or 1w")
+	iCmd.Var(&opts.iMinSize, "min-size", "only show images of at least this size, like 500MB")
+	iCmd.Var(&opts.iMaxSize, "max-size", "only show images of at most this size, like 2GB")
+	iFormat := iCmd.String("format", "", "table (default), markdown, json, or a Go template for output, inline or from file with @path")
+	addTableFlags(iCmd)
+	iTemplateFile := iCmd.String("template-file", "", "read Go template for output from file")
+	iCmd.BoolVar(&opts.jsonCompact, "compact", false, "with --format json, one object per line")
+	addListingFlags(iCmd, &opts, "images", true)
 	vCmd := pflag.NewFlagSet("v", pflag.ExitOnError)
+	vCmd.StringVar(&opts.vDriver, "driver", "", "only show volumes with this driver")
+	vCmd.StringArrayVar(&opts.vLabels, "label", nil, "only show volumes with label key or key=value (repeatable)")
+	vCmd.StringVar(&opts.vName, "name", "", "only show volumes whose name starts with this, or matches it as a\nglob if it has any of *?[ (as examine matches names)")
+	vCmd.BoolVar(&opts.vOrphans, "orphans", false, "only show volumes not used by any container")
+	vFormat := vCmd.String("format", "", "table (default), markdown, json, or a Go template for output, inline or from file with @path")
+	addTableFlags(vCmd)
+	vTemplateFile := vCmd.String("template-file", "", "read Go template for output from file")
+	vCmd.BoolVar(&opts.jsonCompact, "compact", false, "with --format json, one object per line")
+	addListingFlags(vCmd, &opts, "volumes", false)
 	xCmd := pflag.NewFlagSet("x", pflag.ExitOnError)
+	xCmd.BoolVar(&opts.xOneline, "oneline", false, "only print a one-line summary: type id name image state restart-policy")
+	xCmd.BoolVar(&opts.xRegex, "regex", false, "match the args as regular expressions against names, instead of prefixes")
+	xCmd.StringVar(&opts.xDiff, "diff", "", "compare with a snapshot saved with --save, printing added (+),\nremoved (-), and changed (~) fields")
+	xCmd.StringVar(&opts.xSave, "save", "", "save the JSON to file as a snapshot, for later --diff")
+	xCmd.BoolVar(&opts.xFollow, "follow", false, "print a container's state, health, and IP as they change, until\nit is running (and healthy)")
+	xCmd.BoolVar(&opts.xNet, "net", false, "print a table of a container's networks: IP, gateway, MAC, aliases")
+	xCmd.BoolVar(&opts.xRedact, "redact", false, "mask the values of environment variables that look secret, like\n*PASSWORD*, *TOKEN*, *SECRET*, and *KEY* (see README)")
+	xCmd.BoolVar(&opts.xCompact, "compact", false, "print JSON on a single line, and not through pager")
+	diffCmd := pflag.NewFlagSet("diff", pflag.ExitOnError)
+	diffCmd.BoolVar(&opts.diffAdded, "added", false, "show added paths (combinable; default all kinds)")
+	diffCmd.BoolVar(&opts.diffModified, "modified", false, "show changed paths")
+	diffCmd.BoolVar(&opts.diffDeleted, "deleted", false, "show deleted paths")
+	diffCmd.StringVar(&opts.diffPath, "path", "", "only show paths at or below this one")
+	pullCmd := pflag.NewFlagSet("pull", pflag.ExitOnError)
+	searchCmd := pflag.NewFlagSet("search", pflag.ExitOnError)
+	addTableFlags(searchCmd)
+	searchCmd.StringVar(&opts.headerCase, "header-case", "", "upper, lower, or title case column headers")
+	killCmd := pflag.NewFlagSet("kill", pflag.ExitOnError)
+	killCmd.StringVarP(&opts.killSignal, "signal", "s", "SIGKILL", "signal to send")
+	saveCmd := pflag.NewFlagSet("save", pflag.ExitOnError)
+	saveCmd.BoolVar(&opts.archiveForce, "force", false, "overwrite the file if it exists")
+	loadCmd := pflag.NewFlagSet("load", pflag.ExitOnError)
+	pauseCmd := pflag.NewFlagSet("pause", pflag.ExitOnError)
+	unpauseCmd := pflag.NewFlagSet("unpause", pflag.ExitOnError)
+	contextCmd := pflag.NewFlagSet("context", pflag.ExitOnError)
+	portsCmd := pflag.NewFlagSet("ports", pflag.ExitOnError)
+	statsCmd := pflag.NewFlagSet("stats", pflag.ExitOnError)
+	statsCmd.BoolVarP(&opts.statsFollow, "follow", "f", false, "keep updating the line until interrupted")
+	statsCmd.IntVar(&opts.statsRepeat, "repeat", 0, "print this many samples, a line each, then exit")
+	schemaCmd := pflag.NewFlagSet("schema", pflag.ExitOnError)
+	for _, fs := range []*pflag.FlagSet{psCmd, iCmd, vCmd, xCmd, diffCmd, pullCmd, searchCmd,
+		killCmd, saveCmd, loadCmd, pauseCmd, unpauseCmd, contextCmd, portsCmd, statsCmd, schemaCmd} {
+		fs.Var(&errorFormat, "error-format", "report fatal errors as text, or json: {\"error\": ..., \"code\": 1} on stderr")
+	}
+	// Those that talk to the daemon
+	for _, fs := range []*pflag.FlagSet{psCmd, iCmd, vCmd, xCmd, diffCmd, pullCmd, searchCmd,
+		killCmd, saveCmd, loadCmd, pauseCmd, unpauseCmd, portsCmd, statsCmd} {
+		fs.StringVar(&opts.host, "host", "", "docker endpoint, or an alias of one from the config")
+	}
 
 	if len(os.Args) == 1 {
 		fmt.Println("subcommands:")
-		fmt.Println("  ps|c|containers")
-		fmt.Println("  i|imgs|images")
-		fmt.Println("  v|vols|volumes")
-		fmt.Println("  x|examine|inspect")
+		for _, sub := range subcommands {
+			fmt.Printf("  %s\n", strings.TrimSpace(strings.Join(sub.names, "|")+" "+sub.args))
+		}
 		return
 	}
 	switch os.Args[1] {
@@ -65,7 +254,72 @@ cmd (always displayed if term width >= %d).
 			fmt.Printf("Unexpected positional arguments.\n")
 			os.Exit(2)
 		}
-		ps(opts)
+		if !psCmd.Changed("verbose") {
+			if env := os.Getenv("DX_VERBOSE"); env != "" {
+				v, err := strconv.Atoi(env)
+				if err != nil {
+					fmt.Printf("DX_VERBOSE=%q: not an integer.\n", env)
+					os.Exit(2)
+				}
+				opts.psVerbose = v
+			}
+		}
+		applyListingOpts(opts, true)
+		if opts.psOOM {
+			opts.psAll = true
+		}
+		if _, ok := psSorts[opts.psSort]; !ok {
+			fmt.Printf("%q: unknown sort key.\n", opts.psSort)
+			os.Exit(2)
+		}
+		if _, ok := psGroups[opts.psGroupBy]; !ok && opts.psGroupBy != "" {
+			fmt.Printf("%q: unknown group key.\n", opts.psGroupBy)
+			os.Exit(2)
+		}
+		if opts.psWhere != "" {
+			var err error
+			if opts.where, err = parseWhere(opts.psWhere); err != nil {
+				fmt.Printf("--where: %s.\n", err)
+				os.Exit(2)
+			}
+		}
+		for _, col := range opts.psColumns {
+			if _, ok := psColumnLabels[col]; !ok {
+				fmt.Printf("%q: unknown column, expected one of %s.\n", col, strings.Join(psColumnKeys, ","))
+				os.Exit(2)
+			}
+		}
+		switch {
+		case *psWide:
+			opts.psFormat = "wide"
+		case *psCompact && opts.psFormat == "json":
+			opts.jsonCompact = true
+		case *psCompact:
+			opts.psFormat = "compact"
+		}
+		if _, ok := psPresets[opts.psFormat]; ok {
+			opts.tmpl = parseTemplate("", *psTemplateFile)
+		} else {
+			opts.json, opts.tmpl = parseFormat(opts.psFormat, *psTemplateFile)
+		}
+		// Which containers scripts get must not depend on where they run,
+		// and a remote daemon's projects on what is here
+		if !psCmd.Changed("project") && len(opts.psHosts) == 0 &&
+			strings.HasPrefix(clientEndpoint(), "unix://") &&
+			!opts.porcelain && !opts.count && !opts.json && opts.tmpl == nil &&
+			term.IsTerminal(int(os.Stdout.Fd())) {
+			var file string
+			if opts.psProject, file = composeProject(); opts.psProject != "" {
+				fmt.Fprintf(os.Stderr, "Compose project %s, from %s (-p '' for all).\n", opts.psProject, file)
+			}
+		}
+		anyFailed, err := ps(opts)
+		if err != nil {
+			failf("%s", err)
+		}
+		if anyFailed && opts.psFailOnExited {
+			os.Exit(3)
+		}
 	case "i", "imgs", "images":
 		if err := iCmd.Parse(os.Args[2:]); err != nil {
 			panic(err)
@@ -74,6 +328,17 @@ cmd (always displayed if term width >= %d).
 			fmt.Printf("Unexpected positional arguments.\n")
 			os.Exit(2)
 		}
+		if opts.iDedupeLayers {
+			// The actual disk use is only known of all layers together
+			for _, name := range []string{"dangling", "label", "until", "min-size", "max-size"} {
+				if iCmd.Changed(name) {
+					fmt.Printf("--dedupe-layers cannot be combined with --%s.\n", name)
+					os.Exit(2)
+				}
+			}
+		}
+		applyListingOpts(opts, true)
+		opts.json, opts.tmpl = parseFormat(*iFormat, *iTemplateFile)
 		imgs(opts)
 	case "v", "vols", "volumes":
 		if err := vCmd.Parse(os.Args[2:]); err != nil {
@@ -83,220 +348,2296 @@ cmd (always displayed if term width >= %d).
 			fmt.Printf("Unexpected positional arguments.\n")
 			os.Exit(2)
 		}
-		vols()
+		applyListingOpts(opts, false)
+		opts.json, opts.tmpl = parseFormat(*vFormat, *vTemplateFile)
+		vols(opts)
 	case "x", "examine", "inspect":
 		if err := xCmd.Parse(os.Args[2:]); err != nil {
 			panic(err)
 		}
-		if xCmd.NArg() != 1 {
-			fmt.Printf("Expected 1 ID/name (prefix) to examine.\n")
+		setHost(opts.host)
+		if xCmd.NArg() < 1 {
+			fmt.Printf("Expected at least 1 ID/name (prefix), or glob, to examine.\n")
+			os.Exit(2)
+		}
+		if opts.xNet {
+			if xCmd.NArg() != 1 {
+				fmt.Printf("Expected 1 container ID/name (prefix) with --net.\n")
+				os.Exit(2)
+			}
+			examineNet(xCmd.Arg(0))
+			return
+		}
+		if opts.xFollow {
+			if xCmd.NArg() != 1 {
+				fmt.Printf("Expected 1 container ID/name (prefix) with --follow.\n")
+				os.Exit(2)
+			}
+			follow(xCmd.Arg(0))
+			return
+		}
+		if (opts.xDiff != "" || opts.xSave != "") && xCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 ID/name (prefix) with --diff or --save.\n")
+			os.Exit(2)
+		}
+		if !examine(xCmd.Args(), opts) {
+			os.Exit(1)
+		}
+	case "diff":
+		if err := diffCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if diffCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 container ID/name (prefix).\n")
+			os.Exit(2)
+		}
+		diff(diffCmd.Args()[0], opts)
+	case "pull":
+		if err := pullCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if pullCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 image to pull.\n")
+			os.Exit(2)
+		}
+		pull(pullCmd.Args()[0])
+	case "search":
+		if err := searchCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if searchCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 search term.\n")
+			os.Exit(2)
+		}
+		setHeaderCase(opts.headerCase)
+		search(searchCmd.Args()[0])
+	case "save":
+		if err := saveCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if saveCmd.NArg() != 2 {
+			fmt.Printf("Expected 1 image and the file to save it to.\n")
+			os.Exit(2)
+		}
+		save(saveCmd.Arg(0), saveCmd.Arg(1), opts)
+	case "load":
+		if err := loadCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if loadCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 file to load images from.\n")
+			os.Exit(2)
+		}
+		load(loadCmd.Arg(0))
+	case "kill":
+		if err := killCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if killCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 container ID/name (prefix).\n")
+			os.Exit(2)
+		}
+		kill(killCmd.Args()[0], opts)
+	case "pause":
+		if err := pauseCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if pauseCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 container ID/name (prefix).\n")
+			os.Exit(2)
+		}
+		pause(pauseCmd.Args()[0])
+	case "unpause":
+		if err := unpauseCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if unpauseCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 container ID/name (prefix).\n")
+			os.Exit(2)
+		}
+		unpause(unpauseCmd.Args()[0])
+	case "stats":
+		if err := statsCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if statsCmd.NArg() != 1 {
+			fmt.Printf("Expected 1 container ID/name (prefix).\n")
+			os.Exit(2)
+		}
+		if opts.statsRepeat < 0 {
+			fmt.Printf("%d: cannot repeat a negative number of times.\n", opts.statsRepeat)
+			os.Exit(2)
+		}
+		stats(statsCmd.Args()[0], opts)
+	case "ports":
+		if err := portsCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		setHost(opts.host)
+		if portsCmd.NArg() > 0 {
+			fmt.Printf("Unexpected positional arguments.\n")
+			os.Exit(2)
+		}
+		listPorts()
+	case "context":
+		if err := contextCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		if contextCmd.NArg() != 1 || contextCmd.Arg(0) != "ls" {
+			fmt.Printf("Expected: context ls\n")
+			os.Exit(2)
+		}
+		contextLs()
+	case "schema":
+		if err := schemaCmd.Parse(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		if schemaCmd.NArg() != 1 {
+			fmt.Printf("Expected: schema ps|imgs|vols\n")
 			os.Exit(2)
 		}
-		examine(xCmd.Args()[0])
-	default:
-		fmt.Printf("%q: unknown subcommand.\n", os.Args[1])
-		os.Exit(2)
+		schema(schemaCmd.Arg(0))
+	default:
+		fmt.Printf("%q: unknown subcommand.\n", os.Args[1])
+		if suggestion := suggestSubcommand(os.Args[1]); suggestion != "" {
+			fmt.Printf("Did you mean %q?\n", suggestion)
+		}
+		os.Exit(2)
+	}
+}
+
+// addListingFlags adds the flags that ps, imgs, and vols share, listing
+// objects; with ids, also those for the IDs and sizes of containers and
+// images.
+func addListingFlags(flags *pflag.FlagSet, opts *allOpts, objects string, ids bool) {
+	flags.StringVar(&opts.ageFormat, "age-format", "short", "short (3h), or long with two units (3h20m)")
+	flags.StringVar(&opts.headerCase, "header-case", "", "upper, lower, or title case column headers")
+	flags.BoolVar(&opts.porcelain, "porcelain", false, "stable output for scripts, see README")
+	flags.BoolVar(&opts.count, "count", false, "only print the number of "+objects+" listed")
+	flags.DurationVar(&opts.wait, "wait", 0, "wait up to this long (like 10s) for the daemon to answer")
+	if ids {
+		flags.BoolVar(&opts.rawSize, "raw-size", false, "print sizes as exact byte counts")
+		flags.IntVar(&opts.idLength, "id-length", 6, "number of ID characters to show")
+		flags.BoolVar(&opts.hyperlinks, "hyperlinks", false, "make IDs terminal hyperlinks (OSC 8) to dx://examine/<full ID>")
+	}
+}
+
+// applyListingOpts applies the values of the flags of addListingFlags, given
+// the same ids.
+func applyListingOpts(opts allOpts, ids bool) {
+	setAgeFormat(opts.ageFormat)
+	setHeaderCase(opts.headerCase)
+	daemonWait = opts.wait
+	setHost(opts.host)
+	if ids {
+		rawSizes = opts.rawSize
+		hyperlinks = opts.hyperlinks
+		setIDLength(opts.idLength)
+	}
+}
+
+// subcommands are the names, with aliases, that main dispatches on.
+var subcommands = []struct {
+	names []string
+	args  string
+}{
+	{names: []string{"ps", "c", "containers"}},
+	{names: []string{"i", "imgs", "images"}},
+	{names: []string{"v", "vols", "volumes"}},
+	{names: []string{"x", "examine", "inspect"}},
+	{names: []string{"diff"}},
+	{names: []string{"pull"}},
+	{names: []string{"search"}},
+	{names: []string{"save"}},
+	{names: []string{"load"}},
+	{names: []string{"kill"}},
+	{names: []string{"pause"}},
+	{names: []string{"unpause"}},
+	{names: []string{"stats"}},
+	{names: []string{"ports"}},
+	{names: []string{"context"}, args: "ls"},
+	{names: []string{"schema"}, args: "ps|imgs|vols"},
+}
+
+// suggestSubcommand returns the subcommand name or alias closest to a
+// mistyped one, if any is close enough.
+func suggestSubcommand(typo string) string {
+	best, bestDist := "", 3
+	for _, sub := range subcommands {
+		for _, name := range sub.names {
+			// Don't suggest based on mostly replacing a short alias
+			if d := levenshtein(typo, name); d < bestDist && d < len(name) {
+				best, bestDist = name, d
+			}
+		}
+	}
+	return best
+}
+
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// hostEndpoint is the endpoint given with --host, which wins over DOCKER_HOST
+// and the docker context.
+var hostEndpoint = ""
+
+// setHost sets hostEndpoint from --host, resolving any alias.
+func setHost(host string) {
+	if host == "" {
+		return
+	}
+	endpoint, err := endpointFor(host)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(2)
+	}
+	hostEndpoint = endpoint
+}
+
+// clientEndpoint returns the endpoint newClient connects to: that of --host,
+// DOCKER_HOST, or the docker context, in that order.
+func clientEndpoint() string {
+	endpoint := defaultEndpoint
+	if hostEndpoint != "" {
+		endpoint = hostEndpoint
+	} else if dockerhost := os.Getenv("DOCKER_HOST"); dockerhost != "" {
+		endpoint = dockerhost
+	} else if name := currentContext(); name != "default" {
+		var err error
+		if endpoint, err = contextEndpoint(name); err != nil {
+			fatalf("Context: %s", err)
+		}
+	}
+	return endpoint
+}
+
+func newClient() *docker.Client {
+	endpoint := clientEndpoint()
+	if strings.HasPrefix(endpoint, "unix://") {
+		checkSocketAccess(strings.TrimPrefix(endpoint, "unix://"))
+	}
+
+	client, err := docker.NewClient(endpoint)
+	if err != nil {
+		fatalf("NewClient: %s", err)
+	}
+	if err := waitForDaemon(client); err != nil {
+		fatalf("Ping: %s", err)
+	}
+	return client
+}
+
+// daemonWait is how long newClient waits for the daemon to answer (--wait),
+// like when it is still starting in the background.
+var daemonWait time.Duration
+
+// waitForDaemon pings the daemon until it answers, or daemonWait has passed.
+func waitForDaemon(client *docker.Client) error {
+	if daemonWait <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(daemonWait)
+	for {
+		err := client.Ping()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// maxClockDrift is how far the daemon's clock may be off from ours before
+// checkClockDrift warns that the ages shown, relative to our clock, are off.
+const maxClockDrift = 30 * time.Second
+
+var (
+	clockDriftChecked   = map[string]bool{}
+	clockDriftCheckedMu sync.Mutex
+)
+
+// checkClockDrift warns, once per endpoint, when the daemon's clock differs
+// noticeably from ours, which makes ages look wrong (like negative, or
+// "now" for old containers). Asking the daemon for its time is slow, so
+// this is only done once an age came out negative, see checkAges.
+func checkClockDrift(client *docker.Client) {
+	clockDriftCheckedMu.Lock()
+	checked := clockDriftChecked[client.Endpoint()]
+	clockDriftChecked[client.Endpoint()] = true
+	clockDriftCheckedMu.Unlock()
+	if checked {
+		return
+	}
+
+	sent := time.Now()
+	info, err := client.Info()
+	if err != nil {
+		return
+	}
+	received := time.Now()
+	daemon, err := time.Parse(time.RFC3339Nano, info.SystemTime)
+	if err != nil {
+		return
+	}
+	// The daemon answered somewhere in between
+	drift := daemon.Sub(sent.Add(received.Sub(sent) / 2))
+	ahead := "ahead of"
+	if drift < 0 {
+		drift, ahead = -drift, "behind"
+	}
+	if drift > maxClockDrift+received.Sub(sent) {
+		fmt.Fprintf(os.Stderr, "Warning: the clock of the daemon at %s is %s %s this host's; ages will be off too.\n",
+			client.Endpoint(), drift.Round(time.Second), ahead)
+	}
+}
+
+// checkAges checks the clock drift of the daemon of client if any of ages,
+// in seconds as age gives them, is negative, which a daemon clock ahead of
+// ours makes them. Ages of -1 are unknown.
+func checkAges(client *docker.Client, ages ...int64) {
+	for _, a := range ages {
+		if a < -1 {
+			checkClockDrift(client)
+			return
+		}
+	}
+}
+
+// checkSocketAccess explains the common first-run failure of not being
+// allowed to use the docker socket, instead of letting it surface as a
+// cryptic error from whatever API call comes first.
+func checkSocketAccess(path string) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			failf(`Permission denied connecting to the Docker daemon socket at %s.
+Add your user to the docker group (sudo usermod -aG docker $USER, then log
+in again), or run dx with sudo.`, path)
+		}
+		return
+	}
+	conn.Close()
+}
+
+// ps lists containers, and returns whether any of them failed. With --hosts,
+// it lists what it can, and then returns an error if any host failed.
+func ps(opts allOpts) (bool, error) {
+	width := float64(termwidth())
+	layout := newPsLayout(opts, width)
+	if tableStyle.markdown {
+		layout.shorten = false
+	}
+	if opts.porcelain {
+		layout.listenIP = true
+	}
+	if opts.porcelain || opts.json || opts.tmpl != nil {
+		layout.exposed = true
+	}
+
+	var rows []psRow
+	var hostsErr error
+	if len(opts.psHosts) == 0 {
+		var err error
+		rows, err = psRows(newClient(), opts, layout)
+		if err != nil {
+			failf("%s", err)
+		}
+	} else {
+		layout.host = true
+		rows, hostsErr = psRowsHosts(opts, layout)
+		if opts.psStrict && hostsErr != nil {
+			failf("%s", hostsErr)
+		}
+	}
+
+	if opts.where != nil {
+		kept := []psRow{}
+		for _, row := range rows {
+			if opts.where(row) {
+				kept = append(kept, row)
+			}
+		}
+		rows = kept
+	}
+
+	sortRows(rows, opts.psSort, opts.psMissingFirst)
+	anyFailed := false
+	for _, row := range rows {
+		anyFailed = anyFailed || row.Failed
+	}
+
+	if opts.count {
+		fmt.Println(len(rows))
+		return anyFailed, hostsErr
+	}
+	if opts.porcelain {
+		for _, row := range rows {
+			printPorcelain(row.ID, row.Name, porcelainTime(row.Created), row.Status,
+				row.Image, strings.Join(row.IPs, ","), row.Ports, row.Host)
+		}
+		return anyFailed, hostsErr
+	}
+	if opts.json {
+		outputJSON(rows, opts.jsonCompact)
+		return anyFailed, hostsErr
+	}
+	if opts.tmpl != nil {
+		for _, row := range rows {
+			execTemplate(opts.tmpl, row)
+		}
+		return anyFailed, hostsErr
+	}
+	if opts.psPretty {
+		psCards(rows)
+		return anyFailed, hostsErr
+	}
+
+	// Picking only makes sense with someone at the terminal
+	pick := opts.psInteractive && term.IsTerminal(int(os.Stdin.Fd())) &&
+		term.IsTerminal(int(os.Stdout.Fd()))
+
+	shown := []psRow{}
+	if opts.psGroupBy == "" {
+		shown = psTable(rows, layout, opts, width, pick, 0)
+	} else {
+		key := psGroups[opts.psGroupBy]
+		groups := map[string][]psRow{}
+		keys := []string{}
+		for _, row := range rows {
+			k := key(row)
+			if _, ok := groups[k]; !ok {
+				keys = append(keys, k)
+			}
+			groups[k] = append(groups[k], row)
+		}
+		sort.Strings(keys)
+		for n, k := range keys {
+			if n > 0 {
+				fmt.Println()
+			}
+			label := k
+			if label == "" {
+				label = "-"
+			}
+			fmt.Printf("%s (%d)\n", label, len(groups[k]))
+			shown = append(shown, psTable(groups[k], layout, opts, width, pick, len(shown))...)
+		}
+	}
+
+	if pick {
+		psPick(shown, opts)
+	}
+	return anyFailed, hostsErr
+}
+
+// psTable writes rows as a table, numbered from first+1 if picking. It
+// returns the rows in the order shown, which --tree changes.
+func psTable(rows []psRow, layout psLayout, opts allOpts, width float64, pick bool, first int) []psRow {
+	columns := opts.psColumns
+	if len(columns) == 0 {
+		columns = layout.columns()
+	}
+	header := []column{}
+	if pick {
+		header = append(header, column{key: "#", label: "#"})
+	}
+	for _, col := range columns {
+		header = append(header, column{key: col, label: psColumnLabels[col], right: psNumeric[col]})
+	}
+	labelKeys := []string{}
+	for _, arg := range opts.psLabelColumns {
+		key, label := arg, arg
+		if i := strings.Index(arg, "="); i >= 0 {
+			key, label = arg[:i], arg[i+1:]
+		}
+		labelKeys = append(labelKeys, key)
+		header = append(header, column{key: "label:" + key, label: label})
+	}
+	var branches []string
+	if opts.psTree {
+		rows, branches = psTree(rows)
+	}
+	names := []string{}
+	for _, row := range rows {
+		names = append(names, row.Name)
+	}
+	if layout.shorten {
+		names = shortenUnique(names, int(0.2*width))
+	}
+	lines := [][]string{}
+	for n, row := range rows {
+		cells := map[string]string{
+			"host":     row.Host,
+			"id":       idLink(row.ID),
+			"name":     names[n],
+			"hostname": row.Hostname,
+			"project":  row.Project,
+			"service":  row.Service,
+			"age":      row.AgeHuman,
+			"restart":  row.Restart,
+			"ports":    row.Ports,
+			"cmd":      row.Command,
+			"log":      row.LogSizeHuman,
+			"image":    row.Image,
+			"imageAge": row.ImageAgeHuman,
+		}
+		binds := []string{}
+		for _, bind := range row.Binds {
+			if strings.HasSuffix(bind, ":ro") {
+				binds = append(binds, bind)
+			} else {
+				binds = append(binds, colorize(bind, red))
+			}
+		}
+		cells["binds"] = strings.Join(binds, ",")
+		if branches != nil {
+			cells["name"] = branches[n] + cells["name"]
+		}
+		marks := []string{}
+		if row.OOMKilled {
+			marks = append(marks, colorize("oom", red))
+		}
+		if opts.psBoot && row.BeforeBoot {
+			marks = append(marks, colorize("preboot", yellow))
+		}
+		if row.Idle {
+			marks = append(marks, colorize("idle", yellow))
+		}
+		if opts.psUnhealthy {
+			color := yellow
+			if row.Health == "unhealthy" {
+				color = red
+			}
+			marks = append(marks, colorize(row.Health, color))
+		}
+		if opts.psRestartedWithin > 0 {
+			marks = append(marks, colorize(fmt.Sprintf("%d restarts", row.Restarts), red))
+		}
+		cells["up"] = strings.Join(append([]string{row.State}, marks...), " ")
+		// Without networks of its own, say whose it uses
+		switch {
+		case row.NetworkMode == "host" || row.NetworkMode == "none":
+			cells["ip"] = row.NetworkMode
+		case strings.HasPrefix(row.NetworkMode, "container:"):
+			ref := strings.TrimPrefix(row.NetworkMode, "container:")
+			if j := findRow(rows, row.Host, ref); j >= 0 {
+				ref = rows[j].Name
+			} else {
+				ref = shortID(ref)
+			}
+			cells["ip"] = "→" + ref
+		case layout.allIPs:
+			cells["ip"] = strings.Join(row.IPs, ",")
+		default:
+			cells["ip"] = row.IP
+		}
+		if layout.shorten {
+			cells["cmd"] = shortenMiddle(cells["cmd"], int(0.15*width))
+			cells["image"] = shorten(cells["image"], int(0.2*width))
+		}
+
+		line := []string{}
+		if pick {
+			line = append(line, strconv.Itoa(first+n+1))
+		}
+		for _, col := range columns {
+			line = append(line, cells[col])
+		}
+		for _, key := range labelKeys {
+			line = append(line, row.Labels[key])
+		}
+		lines = append(lines, line)
+	}
+	highlight(lines, opts.psHighlight)
+	writeTable(header, lines)
+	return rows
+}
+
+// psPick prompts for the number of a listed container, and examines it, or
+// shows its changes with "diff N". An empty answer quits.
+func psPick(rows []psRow, opts allOpts) {
+	if len(rows) == 0 {
+		return
+	}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "Examine # (or diff #): ")
+		line, _ := in.ReadString('\n')
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+		action := "examine"
+		if len(fields) == 2 && (fields[0] == "diff" || fields[0] == "x" || fields[0] == "examine") {
+			action, fields = fields[0], fields[1:]
+		}
+		n, err := strconv.Atoi(fields[0])
+		if len(fields) != 1 || err != nil || n < 1 || n > len(rows) {
+			fmt.Fprintf(os.Stderr, "%q: expected a row number 1-%d.\n", strings.TrimSpace(line), len(rows))
+			continue
+		}
+
+		row := rows[n-1]
+		if row.Host != "" {
+			// The row's --hosts entry, for newClient
+			hostEndpoint, _ = endpointFor(row.Host)
+		}
+		if action == "diff" {
+			diff(row.ID, opts)
+		} else if !examine([]string{row.ID}, opts) {
+			os.Exit(1)
+		}
+		return
+	}
+}
+
+// psCards prints rows as blocks of labelled lines, for --pretty.
+func psCards(rows []psRow) {
+	for n, row := range rows {
+		if n > 0 {
+			fmt.Println()
+		}
+		name := row.Name
+		if row.Host != "" {
+			name = row.Host + " " + name
+		}
+		ip := strings.Join(row.IPs, ",")
+		if row.NetworkMode == "host" || row.NetworkMode == "none" ||
+			strings.HasPrefix(row.NetworkMode, "container:") {
+			ip = row.NetworkMode
+		}
+		fmt.Printf("%s %s\n", colorize(row.ID[:idLength], yellow), name)
+		fmt.Printf("  state: %s\n", row.State)
+		fmt.Printf("  image: %s\n", row.Image)
+		fmt.Printf("  ports: %s\n", row.Ports)
+		fmt.Printf("  ip:    %s\n", ip)
+		fmt.Printf("  age:   %s\n", row.AgeHuman)
+	}
+}
+
+// psRowsHosts collects the rows from each of --hosts in parallel. Hosts that
+// fail are reported, and left out, and then make the returned error; with
+// --strict, the first failure is the error, and no rows are returned.
+func psRowsHosts(opts allOpts, layout psLayout) ([]psRow, error) {
+	results := make([][]psRow, len(opts.psHosts))
+	errs := make([]error, len(opts.psHosts))
+	took := make([]time.Duration, len(opts.psHosts))
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, host := range opts.psHosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			defer func(start time.Time) {
+				took[i] = time.Since(start)
+			}(time.Now())
+			endpoint, err := endpointFor(host)
+			var client *docker.Client
+			if err == nil {
+				client, err = docker.NewClient(endpoint)
+			}
+			if err == nil {
+				err = waitForDaemon(client)
+			}
+			if err == nil {
+				results[i], err = psRows(client, opts, layout)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", host, err)
+				return
+			}
+			for n := range results[i] {
+				results[i][n].Host = host
+			}
+		}(i, host)
+	}
+	wg.Wait()
+	if opts.psTiming {
+		// How many hosts were effectively being waited for at once
+		var sum time.Duration
+		for _, d := range took {
+			sum += d
+		}
+		wall := time.Since(start)
+		fmt.Fprintf(os.Stderr, "timing: all hosts %s, concurrency %.1f\n",
+			wall.Round(time.Millisecond), float64(sum)/float64(wall))
+	}
+	failed := 0
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if opts.psStrict {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		failed++
+	}
+	rows := []psRow{}
+	for _, r := range results {
+		rows = append(rows, r...)
+	}
+	if failed > 0 {
+		return rows, fmt.Errorf("Listing failed on %d of %d hosts.", failed, len(opts.psHosts))
+	}
+	return rows, nil
+}
+
+// psRows lists, filters, and inspects the containers of one host.
+func psRows(client *docker.Client, opts allOpts, layout psLayout) ([]psRow, error) {
+	start := time.Now()
+	containers, err := client.ListContainers(
+		docker.ListContainersOptions{
+			All: opts.psAll, Size: false,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("ListContainers: %w", err)
+	}
+
+	if opts.psNetwork != "" {
+		network, err := resolveNetwork(client, opts.psNetwork)
+		if err != nil {
+			return nil, err
+		}
+		containers = filterContainers(containers, func(c docker.APIContainers) bool {
+			for name, cnetwork := range c.Networks.Networks {
+				if cnetwork.NetworkID == network.ID || name == network.Name {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	var ancestor func(c docker.APIContainers, imageID string) bool
+	if opts.psAncestor != "" {
+		if ancestor, err = ancestorFilter(client, opts.psAncestor); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.psProject != "" {
+		containers = filterContainers(containers, func(c docker.APIContainers) bool {
+			return c.Labels["com.docker.compose.project"] == opts.psProject
+		})
+	}
+
+	if opts.psHideInfra {
+		containers = filterContainers(containers, func(c docker.APIContainers) bool {
+			return !infra(c)
+		})
+	}
+
+	listed := time.Now()
+	boot, bootKnown := bootTime(client)
+	var cache *inspectCache
+	if opts.psCache > 0 {
+		cache = loadCache(client.Endpoint(), opts.psCache)
+	}
+	rows := []psRow{}
+	running := []bool{}
+	for _, c := range containers {
+		var cinfo *docker.Container
+		if cache != nil {
+			cinfo = cache.Containers[c.ID]
+		}
+		if cinfo == nil {
+			cinfo, err = client.InspectContainerWithOptions(
+				docker.InspectContainerOptions{ID: c.ID})
+			if noSuchContainer(err) {
+				// Removed since it was listed
+				continue
+			}
+			if err != nil && opts.psStrict {
+				return nil, fmt.Errorf("InspectContainer: %w", err)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "InspectContainer: %s\n", err)
+				// What needs inspecting can't be filtered on
+				if !opts.psOOM && !opts.psUnhealthy && opts.psRestartedWithin == 0 && !opts.psBindMounts && ancestor == nil {
+					rows = append(rows, listedRow(c, layout))
+					running = append(running, false)
+				}
+				continue
+			}
+			if cache != nil {
+				cache.Containers[c.ID] = cinfo
+			}
+		}
+		if ancestor != nil && !ancestor(c, cinfo.Image) {
+			continue
+		}
+		if opts.psOOM && !cinfo.State.OOMKilled {
+			continue
+		}
+		if opts.psUnhealthy && !unhealthy(cinfo) {
+			continue
+		}
+		if opts.psRestartedWithin > 0 && (cinfo.RestartCount == 0 || time.Since(cinfo.State.StartedAt) > opts.psRestartedWithin) {
+			continue
+		}
+		binds := bindMounts(cinfo)
+		if opts.psBindMounts && len(binds) == 0 {
+			continue
+		}
+		row := psRow{
+			ID:          c.ID,
+			Name:        strings.TrimPrefix(cinfo.Name, "/"),
+			Hostname:    hostname(cinfo),
+			Project:     c.Labels["com.docker.compose.project"],
+			Service:     c.Labels["com.docker.compose.service"],
+			Created:     time.Unix(c.Created, 0),
+			State:       state(cinfo.State),
+			Status:      cinfo.State.Status,
+			Health:      cinfo.State.Health.Status,
+			OOMKilled:   cinfo.State.OOMKilled,
+			Restarts:    cinfo.RestartCount,
+			Binds:       binds,
+			Failed:      failed(cinfo.State),
+			Restart:     restartPolicy(cinfo),
+			Parent:      namespaceParent(cinfo),
+			NetworkMode: networkMode(cinfo),
+			IPs:         ips(c.Networks),
+			Ports:       ports(c.Ports, layout.listenIP, layout.exposed),
+			Command:     c.Command,
+			Image:       c.Image,
+			Labels:      c.Labels,
+		}
+		if len(row.IPs) > 0 {
+			row.IP = row.IPs[0]
+		}
+		row.Age, row.AgeHuman = age(row.Created)
+		if bootKnown && !cinfo.State.StartedAt.IsZero() {
+			row.BeforeBoot = cinfo.State.StartedAt.Before(boot)
+		}
+		row.LogSize, row.LogSizeHuman = logSize(cinfo)
+		switch {
+		case opts.psNoImageAge:
+			// Left unknown
+		case cache != nil && !cache.ImageCreated[cinfo.Image].IsZero():
+			row.ImageCreated = cache.ImageCreated[cinfo.Image]
+		default:
+			img, err := client.InspectImage(cinfo.Image) // by hash
+			if err != nil && opts.psStrict {
+				return nil, fmt.Errorf("InspectImage: %w", err)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "InspectImage: %s\n", err)
+				break
+			}
+			row.ImageCreated = img.Created
+			if cache != nil {
+				cache.ImageCreated[cinfo.Image] = img.Created
+			}
+		}
+		row.ImageAge, row.ImageAgeHuman = age(row.ImageCreated)
+		checkAges(client, row.Age, row.ImageAge)
+		rows = append(rows, row)
+		running = append(running, cinfo.State.Running)
+	}
+	if cache != nil {
+		cache.save(client.Endpoint())
+	}
+	inspected := time.Now()
+
+	if opts.psIdle {
+		// Each sample takes the daemon a while, so take them together
+		var wg sync.WaitGroup
+		for n := range rows {
+			if !running[n] {
+				continue
+			}
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				cpu, err := sampleCPU(client, rows[n].ID)
+				if noSuchContainer(err) {
+					return
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Stats: %s\n", err)
+					return
+				}
+				rows[n].Idle = cpu < opts.psIdleThreshold
+			}(n)
+		}
+		wg.Wait()
+	}
+
+	if opts.psTiming {
+		prefix := "timing:"
+		if len(opts.psHosts) > 0 {
+			prefix += " " + client.Endpoint()
+		}
+		fmt.Fprintf(os.Stderr, "%s list %s, inspect %s (%d containers)", prefix,
+			listed.Sub(start).Round(time.Millisecond),
+			inspected.Sub(listed).Round(time.Millisecond), len(containers))
+		if opts.psIdle {
+			fmt.Fprintf(os.Stderr, ", cpu samples %s", time.Since(inspected).Round(time.Millisecond))
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	return rows, nil
+}
+
+// listedRow makes a row of what the container listing has, for when
+// inspecting fails. The rest is unknown.
+func listedRow(c docker.APIContainers, layout psLayout) psRow {
+	row := psRow{
+		ID:      c.ID,
+		Name:    containerName(&c),
+		Project: c.Labels["com.docker.compose.project"],
+		Service: c.Labels["com.docker.compose.service"],
+		Created: time.Unix(c.Created, 0),
+		State:   "?",
+		Status:  c.State,
+		IPs:     ips(c.Networks),
+		Ports:   ports(c.Ports, layout.listenIP, layout.exposed),
+		Command: c.Command,
+		Image:   c.Image,
+		Labels:  c.Labels,
+		Binds:   []string{},
+	}
+	if len(row.IPs) > 0 {
+		row.IP = row.IPs[0]
+	}
+	row.Age, row.AgeHuman = age(row.Created)
+	row.LogSize, row.LogSizeHuman = -1, "?"
+	row.ImageAge, row.ImageAgeHuman = age(row.ImageCreated)
+	return row
+}
+
+// psRow is a container as listed by ps, and what --format templates and
+// json get. Ages are in seconds, and sizes in bytes; -1 if unknown. Each has
+// a human readable counterpart.
+type psRow struct {
+	Host          string            `json:"host,omitempty"` // only with --hosts
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Hostname      string            `json:"hostname"`
+	Project       string            `json:"project"`
+	Service       string            `json:"service"`
+	Created       time.Time         `json:"created"`
+	Age           int64             `json:"age"`
+	AgeHuman      string            `json:"ageHuman"`
+	State         string            `json:"state"`
+	Status        string            `json:"status"` // as docker has it, like running
+	Health        string            `json:"health"` // empty without health check
+	OOMKilled     bool              `json:"oomKilled"`
+	Failed        bool              `json:"failed"`
+	Idle          bool              `json:"idle"` // only with --idle
+	Restart       string            `json:"restartPolicy"`
+	Restarts      int               `json:"restartCount"`
+	Binds         []string          `json:"binds"`             // host:container, with :ro if read-only
+	BeforeBoot    bool              `json:"startedBeforeBoot"` // false if boot time unknown
+	Parent        string            `json:"parent,omitempty"`  // whose namespace it joins
+	IP            string            `json:"ip"`                // the first of IPs
+	IPs           []string          `json:"ips"`
+	NetworkMode   string            `json:"networkMode"`
+	Ports         string            `json:"ports"`
+	Command       string            `json:"command"`
+	Labels        map[string]string `json:"labels"`
+	LogSize       int64             `json:"logSize"`
+	LogSizeHuman  string            `json:"logSizeHuman"`
+	Image         string            `json:"image"`
+	ImageCreated  time.Time         `json:"imageCreated"` // zero if unknown
+	ImageAge      int64             `json:"imageAge"`
+	ImageAgeHuman string            `json:"imageAgeHuman"`
+}
+
+// bootTime returns when the docker host last booted. It is only known for a
+// daemon on the local unix socket, from /proc/uptime.
+func bootTime(client *docker.Client) (time.Time, bool) {
+	if !strings.HasPrefix(client.Endpoint(), "unix://") {
+		return time.Time{}, false
+	}
+	b, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return time.Time{}, false
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Now().Add(-time.Duration(uptime * float64(time.Second))), true
+}
+
+// infraImages and infraLabels pick out containers that orchestrators run for
+// themselves, hidden by --hide-infra. Images are globs against the image name
+// without registry, path, and tag; labels are key or key=value. The config
+// can add more.
+var (
+	infraImages = []string{"pause", "kube-proxy"}
+	infraLabels = []string{"io.kubernetes.docker.type=podsandbox"}
+)
+
+func infra(c docker.APIContainers) bool {
+	name := c.Image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	name = name[strings.LastIndex(name, "/")+1:]
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	for _, pattern := range append(infraImages, config.InfraImages...) {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	for _, label := range append(infraLabels, config.InfraLabels...) {
+		key, value := label, ""
+		hasValue := strings.Contains(label, "=")
+		if hasValue {
+			parts := strings.SplitN(label, "=", 2)
+			key, value = parts[0], parts[1]
+		}
+		if v, ok := c.Labels[key]; ok && (!hasValue || v == value) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterContainers(containers []docker.APIContainers,
+	keep func(docker.APIContainers) bool) []docker.APIContainers {
+	kept := []docker.APIContainers{}
+	for _, c := range containers {
+		if keep(c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// ancestorFilter returns a filter keeping containers whose image, by the ID
+// that inspecting them gives, is the one arg resolves to, or, for a bare
+// repository name, that were created with any tag of that repository. The
+// image a tag refers to may have changed since a container was created with
+// it, so its name alone says nothing about its image.
+func ancestorFilter(client *docker.Client, arg string) (func(c docker.APIContainers, imageID string) bool, error) {
+	img, err := client.InspectImage(arg)
+	if err != nil && !errors.Is(err, docker.ErrNoSuchImage) {
+		return nil, fmt.Errorf("InspectImage: %w", err)
+	}
+	repo, tag := docker.ParseRepositoryTag(arg)
+	if img == nil && tag != "" {
+		return nil, fmt.Errorf("Found no image matching: %s", arg)
+	}
+
+	return func(c docker.APIContainers, imageID string) bool {
+		if cRepo, _ := docker.ParseRepositoryTag(c.Image); tag == "" && cRepo == repo {
+			return true
+		}
+		return img != nil && imageID == img.ID
+	}, nil
+}
+
+// resolveContainer finds the container with name or ID arg, or else the
+// single container whose name or ID starts with arg.
+func resolveContainer(client *docker.Client, arg string) (*docker.APIContainers, error) {
+	containers, err := client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		fatalf("ListContainers: %s", err)
+	}
+	matches := []*docker.APIContainers{}
+	for i := range containers {
+		c := &containers[i]
+		if c.ID == arg || contains(c.Names, "/"+arg) {
+			return c, nil
+		}
+		if strings.HasPrefix(c.ID, arg) || hasPrefix(c.Names, "/"+arg) {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("Found no container matching: %s", arg)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("Found multiple containers with prefix: %s", arg)
+	}
+}
+
+func containerName(c *docker.APIContainers) string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// resolveNetwork finds the network with name or ID arg, or else the single
+// network whose name or ID starts with arg.
+func resolveNetwork(client *docker.Client, arg string) (*docker.Network, error) {
+	networks, err := client.ListNetworks()
+	if err != nil {
+		return nil, fmt.Errorf("ListNetworks: %w", err)
+	}
+	matches := []*docker.Network{}
+	for i := range networks {
+		n := &networks[i]
+		if n.Name == arg || n.ID == arg {
+			return n, nil
+		}
+		if strings.HasPrefix(n.Name, arg) || strings.HasPrefix(n.ID, arg) {
+			matches = append(matches, n)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", errNoNetwork, arg)
+	case 1:
+		return matches[0], nil
+	default:
+		lines := []string{}
+		for _, n := range matches {
+			lines = append(lines, "  "+highlightPrefix(shortID(n.ID), arg, useColorStderr)+" "+
+				highlightPrefix(n.Name, arg, useColorStderr))
+		}
+		return nil, fmt.Errorf("%w: %s\n%s", errManyNetworks, arg, strings.Join(lines, "\n"))
+	}
+}
+
+var (
+	errNoNetwork    = errors.New("Found no network matching")
+	errManyNetworks = errors.New("Found multiple networks with prefix")
+)
+
+// psSorts are the orderings of ps rows, besides the default by creation.
+var psSorts = map[string]func(a, b psRow) bool{
+	"created": nil,
+	"name": func(a, b psRow) bool {
+		return a.Name < b.Name
+	},
+	"project": func(a, b psRow) bool {
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.Name < b.Name
+	},
+	"image-age": func(a, b psRow) bool {
+		return a.ImageAge < b.ImageAge
+	},
+}
+
+// sortRows sorts rows by creation, and then by key of psSorts, with those
+// lacking its value last, or first if missingFirst.
+func sortRows(rows []psRow, key string, missingFirst bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].Created.Equal(rows[j].Created) {
+			return rows[i].Created.Before(rows[j].Created)
+		}
+		return rows[i].ID < rows[j].ID
+	})
+	less := psSorts[key]
+	if less == nil {
+		return
+	}
+	missing := psMissing[key]
+	sort.SliceStable(rows, func(i, j int) bool {
+		if missing != nil && missing(rows[i]) != missing(rows[j]) {
+			return missing(rows[j]) != missingFirst
+		}
+		return less(rows[i], rows[j])
+	})
+}
+
+// psMissing tells, for the sort keys whose value can be missing, whether a
+// row lacks it. Those rows sort together at the end (or start).
+var psMissing = map[string]func(row psRow) bool{
+	"project": func(row psRow) bool {
+		return row.Project == ""
+	},
+	"image-age": func(row psRow) bool {
+		return row.ImageCreated.IsZero()
+	},
+}
+
+// psGroups are the keys ps can --group-by.
+var psGroups = map[string]func(row psRow) string{
+	"image": func(row psRow) string {
+		return row.Image
+	},
+	"project": func(row psRow) string {
+		return row.Project
+	},
+}
+
+// psLayout selects the optional columns of ps and whether to shorten values.
+type psLayout struct {
+	host     bool
+	hostname bool
+	project  bool
+	age      bool
+	restart  bool
+	listenIP bool
+	exposed  bool
+	allIPs   bool
+	cmd      bool
+	logSize  bool
+	shorten  bool
+	noImgAge bool
+	binds    bool
+}
+
+// psColumnKeys are the columns of the ps table, in the order of the
+// layouts, for --columns; psColumnLabels their default headings.
+var psColumnKeys = []string{"host", "id", "name", "hostname", "project", "service", "age",
+	"up", "restart", "ip", "ports", "cmd", "log", "image", "imageAge", "binds"}
+
+var psColumnLabels = map[string]string{
+	"host": "host", "id": "id", "name": "name", "hostname": "hostname",
+	"project": "project", "service": "service", "age": "age", "up": "up",
+	"restart": "restart", "ip": "ip", "ports": "ports", "cmd": "cmd",
+	"log": "log", "image": "image", "imageAge": "age", "binds": "binds",
+}
+
+// psNumeric are the columns of ages and sizes, right-aligned like those of
+// imgs and vols.
+var psNumeric = map[string]bool{"age": true, "log": true, "imageAge": true}
+
+// columns returns the keys of the columns the layout shows.
+func (layout psLayout) columns() []string {
+	show := map[string]bool{
+		"host":     layout.host,
+		"hostname": layout.hostname,
+		"project":  layout.project,
+		"service":  layout.project,
+		"age":      layout.age,
+		"restart":  layout.restart,
+		"cmd":      layout.cmd,
+		"log":      layout.logSize,
+		"imageAge": !layout.noImgAge,
+		"binds":    layout.binds,
+	}
+	columns := []string{}
+	for _, col := range psColumnKeys {
+		// Columns that are not optional are always shown
+		if shown, optional := show[col]; shown || !optional {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// psPresets are the layouts selectable with --format. Add any new optional
+// column here too, so that wide stays maximal.
+var psPresets = map[string]psLayout{
+	"wide": {
+		hostname: true,
+		project:  true,
+		age:      true,
+		restart:  true,
+		listenIP: true,
+		exposed:  true,
+		allIPs:   true,
+		cmd:      true,
+		logSize:  true,
+		binds:    true,
+		shorten:  false,
+	},
+	"compact": {
+		shorten: true,
+	},
+}
+
+func psPresetNames() []string {
+	names := []string{}
+	for name := range psPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newPsLayout(opts allOpts, width float64) psLayout {
+	layout, ok := psPresets[opts.psFormat]
+	if !ok {
+		layout = psLayout{
+			age:      opts.psVerbose >= 1,
+			listenIP: opts.psVerbose >= 1,
+			exposed:  opts.psVerbose >= 1,
+			allIPs:   opts.psVerbose >= 1,
+			cmd:      opts.psVerbose >= 1 || width >= WIDE,
+			shorten:  opts.psVerbose < 2,
+		}
+	}
+	// Opt-in columns are added on top of any preset.
+	layout.logSize = layout.logSize || opts.psLogSize
+	layout.hostname = layout.hostname || opts.psHostname
+	layout.project = layout.project || opts.psShowProject
+	layout.restart = layout.restart || opts.psRestartPolicy
+	layout.noImgAge = opts.psNoImageAge
+	layout.binds = layout.binds || opts.psBindMounts
+	return layout
+}
+
+func networkMode(c *docker.Container) string {
+	if c.HostConfig == nil {
+		return ""
+	}
+	return c.HostConfig.NetworkMode
+}
+
+// namespaceParent returns the container (name or ID) whose network, pid, or
+// ipc namespace c joins, if any.
+func namespaceParent(c *docker.Container) string {
+	if c.HostConfig == nil {
+		return ""
+	}
+	for _, mode := range []string{c.HostConfig.NetworkMode, c.HostConfig.PidMode, c.HostConfig.IpcMode} {
+		if strings.HasPrefix(mode, "container:") {
+			return strings.TrimPrefix(mode, "container:")
+		}
+	}
+	return ""
+}
+
+// psTree orders rows into a forest, where containers joining another's
+// namespace follow it as children. It also returns the tree branches to draw
+// before each row's name. Containers whose parent is not listed are roots.
+func psTree(rows []psRow) ([]psRow, []string) {
+	parents := make([]int, len(rows))
+	for i, r := range rows {
+		parents[i] = -1
+		if r.Parent == "" {
+			continue
+		}
+		if j := findRow(rows, r.Host, r.Parent); j != i {
+			parents[i] = j
+		}
+	}
+
+	order, branches := treeOrder(parents)
+	ordered := []psRow{}
+	for _, i := range order {
+		ordered = append(ordered, rows[i])
+	}
+	return ordered, branches
+}
+
+// findRow returns the index of the row of host with name or ID (prefix) ref,
+// or -1.
+func findRow(rows []psRow, host string, ref string) int {
+	for i, r := range rows {
+		if r.Host == host && (r.Name == ref || strings.HasPrefix(r.ID, ref)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// treeOrder walks the forest where item i is a child of parents[i], or a root
+// if that is -1, keeping the order of siblings. It returns the items in tree
+// order, each with the branches to draw before it.
+func treeOrder(parents []int) ([]int, []string) {
+	children := map[int][]int{}
+	for i, p := range parents {
+		if p >= 0 {
+			children[p] = append(children[p], i)
+		}
+	}
+
+	order := []int{}
+	branches := []string{}
+	var walk func(i int, branch string, indent string)
+	walk = func(i int, branch string, indent string) {
+		order = append(order, i)
+		branches = append(branches, branch)
+		for n, child := range children[i] {
+			if n == len(children[i])-1 {
+				walk(child, indent+"└─", indent+"  ")
+			} else {
+				walk(child, indent+"├─", indent+"│ ")
+			}
+		}
+	}
+	for i, p := range parents {
+		if p < 0 {
+			walk(i, "", "")
+		}
+	}
+	return order, branches
+}
+
+// unhealthy tells whether a container's health check fails, or whether it
+// is still starting although checks have run past the start period.
+func unhealthy(c *docker.Container) bool {
+	switch c.State.Health.Status {
+	case "unhealthy":
+		return true
+	case "starting":
+		var startPeriod time.Duration
+		if c.Config != nil && c.Config.Healthcheck != nil {
+			startPeriod = c.Config.Healthcheck.StartPeriod
+		}
+		grace := c.State.StartedAt.Add(startPeriod)
+		for _, check := range c.State.Health.Log {
+			if check.Start.After(grace) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bindMounts returns the host directories and files mounted into a
+// container, as host:container, with :ro if read-only. Volumes have a name,
+// and tmpfs mounts no source.
+func bindMounts(c *docker.Container) []string {
+	binds := []string{}
+	for _, m := range c.Mounts {
+		if m.Name != "" || m.Source == "" {
+			continue
+		}
+		bind := m.Source + ":" + m.Destination
+		if !m.RW {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+	}
+	return binds
+}
+
+// noSuchContainer tells whether err is that of a container that is not
+// there, like one removed since it was listed.
+func noSuchContainer(err error) bool {
+	var errNoSuch *docker.NoSuchContainer
+	return errors.As(err, &errNoSuch)
+}
+
+// failed tells whether a container ended badly, or is failing to stay up.
+func failed(state docker.State) bool {
+	switch {
+	case state.RemovalInProgress || state.Status == "removing":
+		// Dead on its way out, as asked for
+		return false
+	case state.Dead, state.OOMKilled, state.Restarting:
+		return true
+	case !state.Running && !state.FinishedAt.IsZero():
+		return state.ExitCode != 0
+	}
+	return false
+}
+
+// restartPolicy formats the policy like docker run --restart takes it.
+func restartPolicy(c *docker.Container) string {
+	if c.HostConfig == nil || c.HostConfig.RestartPolicy.Name == "" {
+		return "no"
+	}
+	policy := c.HostConfig.RestartPolicy
+	if policy.Name == "on-failure" && policy.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", policy.Name, policy.MaximumRetryCount)
+	}
+	return policy.Name
+}
+
+// hostname returns the container's own idea of its (fully qualified)
+// hostname, which is what its peers resolve rather than the container name.
+func hostname(c *docker.Container) string {
+	if c.Config == nil {
+		return ""
+	}
+	if c.Config.Domainname != "" {
+		return c.Config.Hostname + "." + c.Config.Domainname
+	}
+	return c.Config.Hostname
+}
+
+// logSize returns the size of the container's log file, which we can only
+// find for the json-file and local logging drivers. The file is stat'ed
+// directly, so this only works against a local daemon.
+func logSize(c *docker.Container) (int64, string) {
+	if c.HostConfig == nil {
+		return -1, "-"
+	}
+	var path string
+	switch c.HostConfig.LogConfig.Type {
+	case "json-file":
+		path = c.LogPath
+	case "local":
+		path = filepath.Join(filepath.Dir(c.ResolvConfPath), "local-logs", "container.log")
+	default:
+		return -1, "-"
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return -1, "?"
+	}
+	return fi.Size(), prettySize(fi.Size())
+}
+
+func imgs(opts allOpts) {
+	client := newClient()
+	filters := map[string][]string{}
+	if opts.iDangling {
+		filters["dangling"] = []string{"true"}
+	}
+	if len(opts.iLabels) > 0 {
+		filters["label"] = opts.iLabels
+	}
+	imgs, err := client.ListImages(
+		docker.ListImagesOptions{
+			All: opts.iAll, Filters: filters,
+		})
+	if err != nil {
+		fatalf("ListImages: %s", err)
+	}
+
+	sort.SliceStable(imgs, func(i, j int) bool {
+		if imgs[i].Created != imgs[j].Created {
+			return imgs[i].Created < imgs[j].Created
+		}
+		return imgs[i].ID < imgs[j].ID
+	})
+
+	rows := []imgRow{}
+	for _, i := range imgs {
+		if i.Size < int64(opts.iMinSize) || opts.iMaxSize > 0 && i.Size > int64(opts.iMaxSize) {
+			continue
+		}
+		if opts.iUntil > 0 && time.Since(time.Unix(i.Created, 0)) < time.Duration(opts.iUntil) {
+			continue
+		}
+		// strip any "hashName:" prefix
+		idParts := strings.SplitN(i.ID, ":", 2)
+		row := imgRow{
+			ID:        idParts[len(idParts)-1],
+			Created:   time.Unix(i.Created, 0),
+			Size:      i.Size,
+			SizeHuman: prettySize(i.Size),
+			Source:    imageSource(i),
+			Parent:    strings.TrimPrefix(i.ParentID, "sha256:"),
+			RepoTags:  i.RepoTags,
+		}
+		row.Age, row.AgeHuman = age(row.Created)
+		checkAges(client, row.Age)
+		rows = append(rows, row)
+	}
+
+	var used map[string]time.Time
+	if opts.iLastUsed || opts.iDangling {
+		used = imageUse(client, rows)
+	}
+	if opts.iLastUsed {
+		for n, row := range rows {
+			last, ok := used[row.ID]
+			switch {
+			case !ok:
+				rows[n].LastUsedHuman = "never"
+			case last.IsZero():
+				rows[n].LastUsed = time.Now()
+				rows[n].LastUsedHuman = "running"
+			default:
+				rows[n].LastUsed = last
+				_, rows[n].LastUsedHuman = age(last)
+			}
+		}
+	}
+
+	if opts.count {
+		fmt.Println(len(rows))
+		return
+	}
+	if opts.porcelain {
+		for _, row := range rows {
+			printPorcelain(row.ID, porcelainTime(row.Created), strconv.FormatInt(row.Size, 10),
+				row.Source, strings.Join(row.RepoTags, ","))
+		}
+		return
+	}
+	if opts.json {
+		outputJSON(rows, opts.jsonCompact)
+		return
+	}
+	if opts.tmpl != nil {
+		for _, row := range rows {
+			execTemplate(opts.tmpl, row)
+		}
+		return
+	}
+
+	order := make([]int, len(rows))
+	var branches []string
+	if opts.iTree {
+		order, branches = imgTree(rows)
+	} else {
+		for n := range rows {
+			order[n] = n
+		}
+	}
+
+	lines := [][]string{}
+	for t, n := range order {
+		row := rows[n]
+		id := idLink(row.ID)
+		if branches != nil {
+			// Tagged images are what was built or pulled, the rest are
+			// intermediate layers
+			color := plain
+			if len(row.RepoTags) > 0 && row.RepoTags[0] != "<none>:<none>" {
+				color = green
+			}
+			id = branches[t] + colorize(id, color)
+		}
+		line := []string{id, row.AgeHuman, row.SizeHuman}
+		if opts.iLastUsed {
+			line = append(line, row.LastUsedHuman)
+		}
+		lines = append(lines, append(line, row.Source, strings.Join(row.RepoTags, ",")))
+	}
+	columns := []column{
+		{key: "id", label: "id"},
+		{key: "age", label: "age", right: true},
+		{key: "size", label: "size", right: true},
+	}
+	if opts.iLastUsed {
+		columns = append(columns, column{key: "lastUsed", label: "used", right: true})
+	}
+	columns = append(columns, column{key: "source", label: "source"},
+		column{key: "repotags", label: "repotags"})
+	writeTable(columns, lines)
+
+	if opts.iDangling {
+		// Prune leaves images that containers (even stopped ones) use
+		var reclaimable int64
+		inUse := 0
+		for _, row := range rows {
+			if _, ok := used[row.ID]; ok {
+				inUse++
+			} else {
+				reclaimable += row.Size
+			}
+		}
+		fmt.Printf("\nreclaimable: %s", prettySize(reclaimable))
+		if inUse > 0 {
+			fmt.Printf(" (%d in use by containers)", inUse)
+		}
+		fmt.Printf("\n")
+	}
+
+	if opts.iDedupeLayers {
+		// Each image's size includes the layers it shares with others
+		var sum int64
+		for _, row := range rows {
+			sum += row.Size
+		}
+		du, err := client.DiskUsage(docker.DiskUsageOptions{})
+		if err != nil {
+			fatalf("DiskUsage: %s", err)
+		}
+		fmt.Printf("\nsum of image sizes: %s, actual disk (all layers): %s\n",
+			prettySize(sum), prettySize(du.LayersSize))
+	}
+}
+
+// imageUse lists all containers, running or not, and returns per image ID
+// when a container of it was last created, or a zero time if one is
+// running. Images no container uses are left out. Containers refer to images
+// by the name they were run with, or by ID when that was untagged since.
+func imageUse(client *docker.Client, rows []imgRow) map[string]time.Time {
+	containers, err := client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		fatalf("ListContainers: %s", err)
+	}
+	ids := map[string]string{}
+	for _, row := range rows {
+		for _, tag := range row.RepoTags {
+			ids[tag] = row.ID
+		}
+	}
+	used := map[string]time.Time{}
+	for _, c := range containers {
+		id := strings.TrimPrefix(c.Image, "sha256:")
+		if tagged, ok := ids[c.Image]; ok {
+			id = tagged
+		} else if tagged, ok := ids[c.Image+":latest"]; ok {
+			id = tagged
+		}
+		last, seen := used[id]
+		created := time.Unix(c.Created, 0)
+		switch {
+		case c.State == "running":
+			used[id] = time.Time{}
+		case !seen || !last.IsZero() && created.After(last):
+			used[id] = created
+		}
+	}
+	return used
+}
+
+// imgTree orders images under their parent image, for --tree. Images whose
+// parent is not listed are roots.
+func imgTree(rows []imgRow) ([]int, []string) {
+	index := map[string]int{}
+	for n, row := range rows {
+		index[row.ID] = n
+	}
+	parents := make([]int, len(rows))
+	for n, row := range rows {
+		parents[n] = -1
+		if p, ok := index[row.Parent]; ok {
+			parents[n] = p
+		}
+	}
+	return treeOrder(parents)
+}
+
+// imgRow is an image as listed by imgs, and what --format templates and json
+// get.
+type imgRow struct {
+	ID        string    `json:"id"`
+	Created   time.Time `json:"created"`
+	Age       int64     `json:"age"`
+	AgeHuman  string    `json:"ageHuman"`
+	Size      int64     `json:"size"`
+	SizeHuman string    `json:"sizeHuman"`
+	Source    string    `json:"source"`
+	Parent    string    `json:"parent"` // empty for pulled images
+	RepoTags  []string  `json:"repoTags"`
+
+	// Only with --last-used; zero if never used
+	LastUsed      time.Time `json:"lastUsed"`
+	LastUsedHuman string    `json:"lastUsedHuman"`
+}
+
+func vols(opts allOpts) {
+	client := newClient()
+	filters := map[string][]string{}
+	if opts.vDriver != "" {
+		filters["driver"] = []string{opts.vDriver}
+	}
+	if len(opts.vLabels) > 0 {
+		filters["label"] = opts.vLabels
+	}
+	vols, err := client.ListVolumes(docker.ListVolumesOptions{Filters: filters})
+	if err != nil {
+		fatalf("ListVolumes: %s", err)
+	}
+
+	if opts.vName != "" {
+		glob := strings.ContainsAny(opts.vName, "*?[")
+		if _, err := path.Match(opts.vName, ""); glob && err != nil {
+			fmt.Printf("%q: invalid glob: %s\n", opts.vName, err)
+			os.Exit(2)
+		}
+		named := []docker.Volume{}
+		for _, v := range vols {
+			ok := strings.HasPrefix(v.Name, opts.vName)
+			if glob {
+				ok, _ = path.Match(opts.vName, v.Name)
+			}
+			if ok {
+				named = append(named, v)
+			}
+		}
+		vols = named
+	}
+
+	used := volumeUsers(client)
+	if opts.vOrphans {
+		orphans := []docker.Volume{}
+		for _, v := range vols {
+			if used[v.Name] == 0 {
+				orphans = append(orphans, v)
+			}
+		}
+		vols = orphans
+	}
+
+	sort.SliceStable(vols, func(i, j int) bool {
+		if !vols[i].CreatedAt.Equal(vols[j].CreatedAt) {
+			return vols[i].CreatedAt.Before(vols[j].CreatedAt)
+		}
+		return vols[i].Name < vols[j].Name
+	})
+
+	rows := []volRow{}
+	for _, v := range vols {
+		row := volRow{
+			Name:    v.Name,
+			Driver:  v.Driver,
+			Created: v.CreatedAt,
+			Used:    used[v.Name],
+		}
+		row.Age, row.AgeHuman = age(row.Created)
+		checkAges(client, row.Age)
+		rows = append(rows, row)
+	}
+
+	if opts.count {
+		fmt.Println(len(rows))
+		return
+	}
+	if opts.porcelain {
+		for _, row := range rows {
+			printPorcelain(row.Name, row.Driver, porcelainTime(row.Created), strconv.Itoa(row.Used))
+		}
+		return
+	}
+	if opts.json {
+		outputJSON(rows, opts.jsonCompact)
+		return
+	}
+	if opts.tmpl != nil {
+		for _, row := range rows {
+			execTemplate(opts.tmpl, row)
+		}
+		return
 	}
-}
 
-func newClient() *docker.Client {
-	endpoint := "unix:///var/run/docker.sock"
-	if dockerhost := os.Getenv("DOCKER_HOST"); dockerhost != "" {
-		endpoint = dockerhost
+	lines := [][]string{}
+	for _, row := range rows {
+		lines = append(lines, []string{row.AgeHuman, strconv.Itoa(row.Used), row.Driver,
+			highlightPrefix(row.Name, opts.vName, useColor)})
 	}
+	writeTable([]column{
+		{key: "age", label: "age", right: true},
+		{key: "used", label: "used", right: true},
+		{key: "driver", label: "driver"},
+		{key: "name", label: "name"},
+	}, lines)
+}
 
-	client, err := docker.NewClient(endpoint)
-	if err != nil {
-		log.Fatalf("NewClient: %s", err)
+// volRow is a volume as listed by vols, and what --format templates and json
+// get.
+type volRow struct {
+	Name     string    `json:"name"`
+	Driver   string    `json:"driver"`
+	Created  time.Time `json:"created"`
+	Age      int64     `json:"age"`
+	AgeHuman string    `json:"ageHuman"`
+	Used     int       `json:"used"`
+}
+
+// imageSource tells whether an image came from a registry, which is when it
+// has a repo digest, or was produced locally (built, committed, or loaded
+// from a tarball).
+func imageSource(img docker.APIImages) string {
+	if len(img.RepoDigests) > 0 {
+		return "registry"
 	}
-	return client
+	return "local"
 }
 
-func ps(opts allOpts) {
-	client := newClient()
-	containers, err := client.ListContainers(
-		docker.ListContainersOptions{
-			All: opts.psAll, Size: false,
-		})
+// volumeUsers counts, per volume name, the containers (running or not) that
+// mount it, with a single container listing.
+func volumeUsers(client *docker.Client) map[string]int {
+	containers, err := client.ListContainers(docker.ListContainersOptions{All: true})
 	if err != nil {
-		log.Fatalf("ListContainers: %s", err)
+		fatalf("ListContainers: %s", err)
 	}
-
-	sort.Slice(containers, func(i, j int) bool {
-		return containers[i].Created < containers[j].Created
-	})
-
-	width := float64(termwidth())
-
-	w := tabwriter.NewWriter(os.Stdout, 0, 2, 1, ' ', 0)
-	header := "id\tname"
-	if opts.psVerbose >= 1 {
-		header += "\tage"
+	used := map[string]int{}
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			if m.Type == "volume" {
+				used[m.Name]++
+			}
+		}
 	}
-	header += "\tup\tip\tports"
-	if opts.psVerbose >= 1 || width >= WIDE {
-		header += "\tcmd"
+	return used
+}
+
+func examine(args []string, opts allOpts) bool {
+	// Patterns are checked before looking anything up
+	matchers := make([]func(string) bool, len(args))
+	for i, arg := range args {
+		switch {
+		case opts.xRegex:
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				fmt.Printf("%q: invalid regex: %s\n", arg, err)
+				os.Exit(2)
+			}
+			matchers[i] = re.MatchString
+		case strings.ContainsAny(arg, "*?["):
+			if _, err := path.Match(arg, ""); err != nil {
+				fmt.Printf("%q: invalid glob: %s\n", arg, err)
+				os.Exit(2)
+			}
+			glob := arg
+			matchers[i] = func(name string) bool {
+				ok, _ := path.Match(glob, name)
+				return ok
+			}
+		}
 	}
-	header += "\timage\tage"
-	fmt.Fprint(w, header)
-	for _, c := range containers {
-		cinfo, err := client.InspectContainerWithOptions(
-			docker.InspectContainerOptions{ID: c.ID})
+
+	client := newClient()
+	var buf bytes.Buffer
+	failed := false
+	for i, arg := range args {
+		var obj interface{}
+		var objType, id string
+		var err error
+		if matchers[i] != nil {
+			obj, objType, id, err = resolveMatch(client, matchers[i])
+		} else {
+			obj, objType, id, err = resolve(client, arg)
+		}
 		if err != nil {
-			log.Fatalf("InspectContainer: %s", err)
+			reportf("%s: %s", arg, err)
+			failed = true
+			continue
 		}
-		fmt.Fprintf(w, "\n")
-		fmt.Fprintf(w, "%s", c.ID[:6])
-		cname := strings.TrimPrefix(cinfo.Name, "/")
-		if opts.psVerbose < 2 {
-			cname = shorten(cname, int(0.2*width))
+		if opts.xRedact {
+			redact(obj)
 		}
-		fmt.Fprintf(w, "\t%s", cname)
-		if opts.psVerbose >= 1 {
-			fmt.Fprintf(w, "\t%s", prettyDuration(time.Since(time.Unix(c.Created, 0))))
+		if opts.xDiff != "" || opts.xSave != "" {
+			fmt.Fprintf(os.Stderr, "Found %s: %s\n", objType, id)
+			snapshot(obj, opts)
+			continue
 		}
-		fmt.Fprintf(w, "\t%s", state(cinfo.State))
-
-		// TODO, only one IP?
-		ips := ips(c.Networks)
-		fmt.Fprintf(w, "\t%s", ips[0])
-
-		fmt.Fprintf(w, "\t%s", ports(c.Ports, opts.psVerbose))
-
-		if opts.psVerbose >= 1 || width >= WIDE {
-			cmd := c.Command
-			if opts.psVerbose < 2 {
-				cmd = shortenMiddle(cmd, int(0.15*width))
-			}
-			fmt.Fprintf(w, "\t%s", cmd)
+		if opts.xOneline {
+			fmt.Println(oneline(obj))
+			continue
 		}
-
-		imgName := c.Image
-		if opts.psVerbose < 2 {
-			imgName = shorten(imgName, int(0.2*width))
+		if opts.xCompact {
+			b, err := json.Marshal(obj)
+			if err != nil {
+				fatalf("Marshal: %s", err)
+			}
+			fmt.Printf("%s\n", b)
+			continue
 		}
-		fmt.Fprintf(w, "\t%s", imgName)
-
-		imgAge := "?"
-		img, err := client.InspectImage(cinfo.Image) // by hash
+		fmt.Fprintf(os.Stderr, "Found %s: %s\n", objType, id)
+		b, err := json.MarshalIndent(obj, "", "  ")
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "\nInspectImage: %s\n", err)
-		} else {
-			imgAge = prettyDuration(time.Since(img.Created))
+			fatalf("Marshal: %s", err)
 		}
-		fmt.Fprintf(w, "\t%s", imgAge)
-	}
-	fmt.Fprintf(w, "\n")
-	w.Flush()
-}
-
-func imgs(opts allOpts) {
-	client := newClient()
-	imgs, err := client.ListImages(
-		docker.ListImagesOptions{
-			All: opts.iAll,
-		})
-	if err != nil {
-		log.Fatalf("ListImages: %s", err)
+		if len(args) > 1 {
+			fmt.Fprintf(&buf, "==> %s %s (%s) <==\n", objType, id, arg)
+		}
+		fmt.Fprintf(&buf, "%s\n", b)
 	}
-
-	sort.Slice(imgs, func(i, j int) bool {
-		return imgs[i].Created < imgs[j].Created
-	})
-
-	w := new(tabwriter.Writer)
-	w.Init(os.Stdout, 0, 2, 1, ' ', 0)
-	fmt.Fprintf(w, "id\tage\tsize\trepotags")
-	for _, i := range imgs {
-		// strip any "hashName:" prefix
-		idParts := strings.SplitN(i.ID, ":", 2)
-		id := idParts[len(idParts)-1]
-		fmt.Fprintf(w, "\n")
-		fmt.Fprintf(w, "%s", id[:6])
-		fmt.Fprintf(w, "\t%s", prettyDuration(time.Since(time.Unix(i.Created, 0))))
-		fmt.Fprintf(w, "\t%s", prettySize(i.Size))
-		fmt.Fprintf(w, "\t%s", strings.Join(i.RepoTags, ","))
+	if buf.Len() > 0 {
+		output(buf.Bytes())
 	}
-	fmt.Fprintf(w, "\n")
-	w.Flush()
+	return !failed
 }
 
-func vols() {
-	client := newClient()
-	vols, err := client.ListVolumes(docker.ListVolumesOptions{})
-	if err != nil {
-		log.Fatalf("ListVolumes: %s", err)
-	}
-
-	sort.Slice(vols, func(i, j int) bool {
-		return vols[i].CreatedAt.Before(vols[j].CreatedAt)
-	})
+// secretEnv are substrings of the names of environment variables whose
+// values examine --redact masks, in any case. The config can add more.
+var secretEnv = []string{"PASSWORD", "PASSWD", "TOKEN", "SECRET", "KEY"}
 
-	w := new(tabwriter.Writer)
-	w.Init(os.Stdout, 0, 2, 1, ' ', 0)
-	fmt.Fprintf(w, "age\tdriver\tname")
-	for _, v := range vols {
-		fmt.Fprintf(w, "\n")
-		fmt.Fprintf(w, "%s", prettyDuration(time.Since(v.CreatedAt)))
-		fmt.Fprintf(w, "\t%s", v.Driver)
-		fmt.Fprintf(w, "\t%s", v.Name)
+// redact masks the values of secret looking environment variables of a
+// container, as KEY=***.
+func redact(obj interface{}) {
+	c, ok := obj.(*docker.Container)
+	if !ok || c.Config == nil {
+		return
+	}
+	for i, env := range c.Config.Env {
+		key := strings.SplitN(env, "=", 2)[0]
+		for _, secret := range append(secretEnv, config.SecretEnv...) {
+			if strings.Contains(strings.ToUpper(key), strings.ToUpper(secret)) {
+				c.Config.Env[i] = key + "=***"
+				break
+			}
+		}
 	}
-	fmt.Fprintf(w, "\n")
-	w.Flush()
 }
 
-func examine(arg string) {
-	client := newClient()
+var (
+	errNotFound  = errors.New("found nothing matching")
+	errAmbiguous = errors.New("found multiple volumes with prefix")
+)
+
+// resolve looks for a container, image, volume, or network (in that order)
+// matching arg.
+func resolve(client *docker.Client, arg string) (interface{}, string, string, error) {
 	container, err := client.InspectContainerWithOptions(
 		docker.InspectContainerOptions{ID: arg})
 	if err != nil {
-		var errNoSuch *docker.NoSuchContainer
-		if !errors.As(err, &errNoSuch) {
-			log.Fatalf("InspectContainer: %s", err)
+		if !noSuchContainer(err) {
+			fatalf("InspectContainer: %s", err)
 		}
 	} else {
-		outputFound(container, "container", container.ID)
-		return
+		return container, "container", container.ID, nil
 	}
 
 	img, err := client.InspectImage(arg)
 	if err != nil {
 		if !errors.Is(err, docker.ErrNoSuchImage) {
-			log.Fatalf("InspectImage: %s", err)
+			fatalf("InspectImage: %s", err)
 		}
 	} else {
-		outputFound(img, "image", img.ID)
-		return
+		return img, "image", img.ID, nil
 	}
 
-	var vol *docker.Volume
+	matches := []*docker.Volume{}
 	vols, err := client.ListVolumes(docker.ListVolumesOptions{})
 	if err != nil {
-		log.Fatalf("ListVolumes: %s", err)
+		fatalf("ListVolumes: %s", err)
 	}
 	for i := range vols {
+		if vols[i].Name == arg {
+			// Even if it is also a prefix of others
+			return &vols[i], "volume", vols[i].Name, nil
+		}
 		if strings.HasPrefix(vols[i].Name, arg) {
-			if vol != nil {
-				fmt.Fprintf(os.Stderr, "Found multiple volumes with prefix: %s\n", arg)
-				return
-			}
-			vol = &vols[i]
+			matches = append(matches, &vols[i])
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], "volume", matches[0].Name, nil
+	} else if len(matches) > 1 {
+		lines := []string{}
+		for _, vol := range matches {
+			lines = append(lines, "  "+highlightPrefix(vol.Name, arg, useColorStderr))
 		}
+		return nil, "", "", fmt.Errorf("%w:\n%s", errAmbiguous, strings.Join(lines, "\n"))
+	}
+
+	network, err := resolveNetwork(client, arg)
+	if err == nil {
+		network, err = client.NetworkInfo(network.ID)
+		if err != nil {
+			fatalf("NetworkInfo: %s", err)
+		}
+		return network, "network", network.ID, nil
+	} else if errors.Is(err, errManyNetworks) {
+		return nil, "", "", err
+	} else if !errors.Is(err, errNoNetwork) {
+		fatalf("%s", err)
+	}
+
+	return nil, "", "", errNotFound
+}
+
+// examineNet prints the networks of a container, one per row.
+func examineNet(arg string) {
+	client := newClient()
+	c, err := resolveContainer(client, arg)
+	if err != nil {
+		failf("%s", err)
+	}
+	fmt.Fprintf(os.Stderr, "Found container: %s %s\n", c.ID[:6], containerName(c))
+	cinfo, err := client.InspectContainerWithOptions(
+		docker.InspectContainerOptions{ID: c.ID})
+	if noSuchContainer(err) {
+		failf("Container %s was removed.", c.ID[:6])
+	}
+	if err != nil {
+		fatalf("InspectContainer: %s", err)
+	}
+
+	var networks map[string]docker.ContainerNetwork
+	if cinfo.NetworkSettings != nil {
+		networks = cinfo.NetworkSettings.Networks
 	}
-	if vol != nil {
-		outputFound(vol, "volume", vol.Name)
+	if len(networks) == 0 {
+		mode := "-"
+		if cinfo.HostConfig != nil {
+			mode = cinfo.HostConfig.NetworkMode
+		}
+		fmt.Printf("Container has no networks (network mode: %s).\n", mode)
 		return
 	}
+	names := []string{}
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := [][]string{}
+	for _, name := range names {
+		n := networks[name]
+		ip := n.IPAddress
+		if ip != "" {
+			ip += "/" + strconv.Itoa(n.IPPrefixLen)
+		}
+		if n.GlobalIPv6Address != "" {
+			ip += "," + n.GlobalIPv6Address + "/" + strconv.Itoa(n.GlobalIPv6PrefixLen)
+		}
+		lines = append(lines, []string{name, strings.TrimPrefix(ip, ","),
+			n.Gateway, n.MacAddress, strings.Join(n.Aliases, ",")})
+	}
+	writeTable([]column{
+		{key: "network", label: "network"},
+		{key: "ip", label: "ip"},
+		{key: "gateway", label: "gateway"},
+		{key: "mac", label: "mac"},
+		{key: "aliases", label: "aliases"},
+	}, lines)
+}
 
-	fmt.Fprintf(os.Stderr, "Found nothing matching.\n")
+// highlightPrefix colors prefix in s, when s starts with it, to show what
+// matched. Whether to color is up to where s goes: useColor for stdout, or
+// useColorStderr for messages.
+func highlightPrefix(s string, prefix string, color bool) string {
+	if !color || prefix == "" || !strings.HasPrefix(s, prefix) {
+		return s
+	}
+	return yellow + prefix + reset + s[len(prefix):]
 }
 
-func outputFound(obj interface{}, objType string, id string) {
-	fmt.Fprintf(os.Stderr, "Found %s: %s\n", objType, id)
-	b, err := json.MarshalIndent(obj, "", "  ")
+// resolveMatch looks for the single container, image, or volume whose name
+// (or one of its tags) matches. If several do, the error lists them.
+func resolveMatch(client *docker.Client, match func(string) bool) (interface{}, string, string, error) {
+	type candidate struct{ objType, id, name string }
+	found := []candidate{}
+
+	containers, err := client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		fatalf("ListContainers: %s", err)
+	}
+	for i := range containers {
+		if name := containerName(&containers[i]); match(name) {
+			found = append(found, candidate{"container", containers[i].ID, name})
+		}
+	}
+	imgs, err := client.ListImages(docker.ListImagesOptions{})
+	if err != nil {
+		fatalf("ListImages: %s", err)
+	}
+	for _, img := range imgs {
+		for _, tag := range img.RepoTags {
+			if tag != "<none>:<none>" && match(tag) {
+				found = append(found, candidate{"image", img.ID, tag})
+				break
+			}
+		}
+	}
+	vols, err := client.ListVolumes(docker.ListVolumesOptions{})
+	if err != nil {
+		fatalf("ListVolumes: %s", err)
+	}
+	for _, vol := range vols {
+		if match(vol.Name) {
+			found = append(found, candidate{"volume", vol.Name, vol.Name})
+		}
+	}
+	networks, err := client.ListNetworks()
+	if err != nil {
+		fatalf("ListNetworks: %s", err)
+	}
+	for _, network := range networks {
+		if match(network.Name) {
+			found = append(found, candidate{"network", network.ID, network.Name})
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, "", "", errNotFound
+	case 1:
+	default:
+		lines := []string{}
+		for _, c := range found {
+			lines = append(lines, fmt.Sprintf("  %s %s %s", c.objType, shortID(c.id), c.name))
+		}
+		return nil, "", "", fmt.Errorf("found %d matching:\n%s", len(found), strings.Join(lines, "\n"))
+	}
+
+	c := found[0]
+	switch c.objType {
+	case "container":
+		container, err := client.InspectContainerWithOptions(
+			docker.InspectContainerOptions{ID: c.id})
+		if noSuchContainer(err) {
+			return nil, "", "", fmt.Errorf("container %s was removed", shortID(c.id))
+		}
+		if err != nil {
+			fatalf("InspectContainer: %s", err)
+		}
+		return container, c.objType, container.ID, nil
+	case "image":
+		img, err := client.InspectImage(c.id)
+		if err != nil {
+			fatalf("InspectImage: %s", err)
+		}
+		return img, c.objType, img.ID, nil
+	case "network":
+		network, err := client.NetworkInfo(c.id)
+		if err != nil {
+			fatalf("NetworkInfo: %s", err)
+		}
+		return network, c.objType, network.ID, nil
+	}
+	vol, err := client.InspectVolume(c.id)
 	if err != nil {
-		log.Fatalf("Marshal: %s", err)
+		fatalf("InspectVolume: %s", err)
+	}
+	return vol, c.objType, vol.Name, nil
+}
+
+// shortID shortens a container or image ID, without any "sha256:" prefix, for
+// display.
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// oneline summarizes obj as: type id name image state restart-policy. Fields
+// not applicable to the type are "-".
+func oneline(obj interface{}) string {
+	fields := []string{"-", "-", "-", "-", "-", "-"}
+	switch o := obj.(type) {
+	case *docker.Container:
+		fields = []string{"container", o.ID, strings.TrimPrefix(o.Name, "/"),
+			o.Image, state(o.State), restartPolicy(o)}
+		if o.Config != nil {
+			fields[3] = o.Config.Image
+		}
+	case *docker.Image:
+		fields[0], fields[1] = "image", o.ID
+		if len(o.RepoTags) > 0 {
+			fields[2] = strings.Join(o.RepoTags, ",")
+		}
+	case *docker.Volume:
+		fields[0], fields[1], fields[2] = "volume", o.Name, o.Name
+	case *docker.Network:
+		fields[0], fields[1], fields[2] = "network", o.ID, o.Name
 	}
+	return strings.Join(fields, " ")
+}
+
+// output writes b to stdout, through the pager if stdout is a terminal.
+func output(b []byte) {
 	var out io.WriteCloser = os.Stdout
 	if term.IsTerminal(int(os.Stdout.Fd())) {
 		var cmd *exec.Cmd
@@ -305,11 +2646,11 @@ func outputFound(obj interface{}, objType string, id string) {
 			out.Close()
 			err := cmd.Wait()
 			if err != nil {
-				log.Fatalf("Wait: %s", err)
+				fatalf("Wait: %s", err)
 			}
 		}()
 	}
-	fmt.Fprintf(out, "%s\n", b)
+	out.Write(b)
 }
 
 func runPager() (*exec.Cmd, io.WriteCloser) {
@@ -320,12 +2661,12 @@ func runPager() (*exec.Cmd, io.WriteCloser) {
 	cmd := exec.Command(pager[0], pager[1:]...)
 	pipe, err := cmd.StdinPipe()
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%s", err)
 	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Start(); err != nil {
-		log.Fatal(err)
+		fatalf("%s", err)
 	}
 	return cmd, pipe
 }
@@ -336,21 +2677,33 @@ func termwidth() int {
 	}
 	width, _, err := term.GetSize(int(os.Stdout.Fd()))
 	if err != nil {
-		log.Fatalf("terminal.GetSize: %s", err)
+		fatalf("terminal.GetSize: %s", err)
 	}
 	return width
 }
 
 func state(state docker.State) string {
 	var sb strings.Builder
+	switch {
+	case state.RemovalInProgress || state.Status == "removing":
+		return "removing"
+	case state.Dead:
+		return "dead"
+	}
 	if !state.Running || state.Restarting {
 		switch {
-		case state.Dead:
-			return "dead"
 		case state.StartedAt.IsZero():
 			return "created"
 		case state.FinishedAt.IsZero():
-			return "FinishedAt==0"
+			// Started but never finished; on its way down, or it went away
+			// without the daemon seeing it exit.
+			switch {
+			case state.Restarting || state.Status == "restarting":
+				return "restarting"
+			case state.Status == "exited":
+				return "killed?"
+			}
+			return "stopping"
 		}
 		if !state.Running {
 			sb.WriteString("exit")
@@ -367,7 +2720,25 @@ func state(state docker.State) string {
 	return sb.String()
 }
 
+// longAges makes prettyDuration use two units (--age-format long).
+var longAges = false
+
+func setAgeFormat(format string) {
+	switch format {
+	case "short":
+		longAges = false
+	case "long":
+		longAges = true
+	default:
+		fmt.Printf("%q: unknown age format.\n", format)
+		os.Exit(2)
+	}
+}
+
 func prettyDuration(duration time.Duration) string {
+	if longAges {
+		return prettyDurationLong(duration)
+	}
 	const (
 		min   = 60
 		hour  = 60 * min
@@ -397,17 +2768,99 @@ func prettyDuration(duration time.Duration) string {
 	}
 }
 
+var durationUnits = []struct {
+	name    string
+	seconds int
+}{
+	{"y", 365 * 24 * 60 * 60},
+	{"M", 30 * 24 * 60 * 60},
+	{"w", 7 * 24 * 60 * 60},
+	{"d", 24 * 60 * 60},
+	{"h", 60 * 60},
+	{"m", 60},
+	{"s", 1},
+}
+
+var durationPart = regexp.MustCompile(`(\d+(?:\.\d+)?)([yMwdhms])`)
+
+// parseDuration is the counterpart of prettyDuration: it parses durations in
+// its units, like 90s, 168h, 2w, or 1d4h. A bare number is seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	seconds := 0.0
+	parsed := ""
+	for _, m := range durationPart.FindAllStringSubmatch(s, -1) {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		for _, u := range durationUnits {
+			if u.name == m[2] {
+				seconds += n * float64(u.seconds)
+			}
+		}
+		parsed += m[0]
+	}
+	if s == "" || parsed != s {
+		return 0, fmt.Errorf("%q: not a duration like 90s, 3h, 2d, or 1w", s)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// prettyDurationLong gives the two most significant units, like 1d4h, with
+// the second left out when zero. Both are truncated, never rounded up.
+func prettyDurationLong(duration time.Duration) string {
+	s := int(duration.Seconds())
+	if s < 1 {
+		return "now"
+	}
+	for i, u := range durationUnits {
+		if s < u.seconds {
+			continue
+		}
+		pretty := fmt.Sprintf("%d%s", s/u.seconds, u.name)
+		if i+1 < len(durationUnits) {
+			next := durationUnits[i+1]
+			if n := s % u.seconds / next.seconds; n > 0 {
+				pretty += fmt.Sprintf("%d%s", n, next.name)
+			}
+		}
+		return pretty
+	}
+	return "now"
+}
+
+// ips returns the addresses of a container in a stable order: on the default
+// bridge first, then by network name. Networks without an address (like host
+// or none) are skipped.
 func ips(networklist docker.NetworkList) []string {
+	names := []string{}
+	for name := range networklist.Networks {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "bridge") != (names[j] == "bridge") {
+			return names[i] == "bridge"
+		}
+		return names[i] < names[j]
+	})
 	s := []string{}
-	for _, cnetwork := range networklist.Networks {
-		s = append(s, cnetwork.IPAddress)
+	for _, name := range names {
+		if ip := networklist.Networks[name].IPAddress; ip != "" {
+			s = append(s, ip)
+		}
 	}
 	return s
 }
 
-func ports(ports []docker.APIPort, verbose int) string {
+// ports formats the published ports as public→private, with the listen IP
+// if listenIP, and if exposed, also the ports only exposed (not published),
+// as just the private port.
+func ports(ports []docker.APIPort, listenIP bool, exposed bool) string {
 	lines := []string{}
 	for _, p := range ports {
+		if p.IP == "" && !exposed {
+			continue
+		}
 		pub := strconv.FormatInt(p.PublicPort, 10)
 		priv := strconv.FormatInt(p.PrivatePort, 10)
 		if p.Type != "tcp" {
@@ -415,7 +2868,7 @@ func ports(ports []docker.APIPort, verbose int) string {
 		}
 		var line string
 		if p.IP != "" {
-			if verbose >= 1 {
+			if listenIP {
 				line = net.JoinHostPort(p.IP, pub) + "→" + priv
 			} else {
 				line = pub + "→" + priv
@@ -441,6 +2894,91 @@ func contains(s []string, e string) bool {
 	return false
 }
 
+func hasPrefix(s []string, prefix string) bool {
+	for i := range s {
+		if strings.HasPrefix(s[i], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Escape codes count towards the width of a tabwriter cell, so for a column
+// to stay aligned, each cell must have the same number of them; writeTable
+// pads them to that. Output written otherwise must take care of it.
+const (
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+	plain  = "\x1b[39m"
+	reset  = "\x1b[0m"
+
+	// As long as each other, for highlight
+	underline   = "\x1b[04m"
+	noUnderline = "\x1b[24m"
+)
+
+var useColor = term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+
+// useColorStderr is useColor for what goes to stderr, which may be a
+// terminal when stdout is not, or the other way around.
+var useColorStderr = term.IsTerminal(int(os.Stderr.Fd())) && os.Getenv("NO_COLOR") == ""
+
+func colorize(s string, color string) string {
+	if !useColor {
+		return s
+	}
+	return color + s + reset
+}
+
+// escapes matches color codes, and the ends of OSC 8 hyperlinks.
+var escapes = regexp.MustCompile("\x1b\\[[0-9;]*m|\x1b\\]8;;[^\x1b]*\x1b\\\\")
+
+// highlight underlines the cells of lines that contain text, in any case.
+// The other cells of their columns get as many escape codes.
+func highlight(lines [][]string, text string) {
+	if !useColor || text == "" || len(lines) == 0 {
+		return
+	}
+	text = strings.ToLower(text)
+	for i := range lines[0] {
+		found := false
+		for _, line := range lines {
+			found = found || strings.Contains(strings.ToLower(escapes.ReplaceAllString(line[i], "")), text)
+		}
+		if !found {
+			continue
+		}
+		for _, line := range lines {
+			if strings.Contains(strings.ToLower(escapes.ReplaceAllString(line[i], "")), text) {
+				line[i] = colorize(line[i], underline)
+			} else {
+				line[i] = colorize(line[i], noUnderline)
+			}
+		}
+	}
+}
+
+// alignRight pads values with leading spaces to the width of the widest one,
+// so that they end up right-aligned in a (left-aligning) tabwriter column.
+// Escape codes take no room.
+func alignRight(values []string) []string {
+	width := func(v string) int {
+		return utf8.RuneCountInString(escapes.ReplaceAllString(v, ""))
+	}
+	most := 0
+	for _, v := range values {
+		if n := width(v); n > most {
+			most = n
+		}
+	}
+	aligned := make([]string, len(values))
+	for i, v := range values {
+		aligned[i] = strings.Repeat(" ", most-width(v)) + v
+	}
+	return aligned
+}
+
 func shorten(s string, l int) string {
 	if len(s) > l {
 		l--
@@ -449,6 +2987,31 @@ func shorten(s string, l int) string {
 	return strings.ReplaceAll(s, "\n", "␤")
 }
 
+// shortenUnique shortens names like shorten, except those that would then
+// look the same: these are shortened in the middle instead, keeping their
+// differing ends, or else left whole.
+func shortenUnique(names []string, l int) []string {
+	short := make([]string, len(names))
+	seen := map[string]int{}
+	for i, name := range names {
+		short[i] = shorten(name, l)
+		seen[short[i]]++
+	}
+	middle := map[string]int{}
+	for i, name := range names {
+		if seen[short[i]] > 1 && short[i] != name {
+			short[i] = shortenMiddle(name, l)
+			middle[short[i]]++
+		}
+	}
+	for i, name := range names {
+		if middle[short[i]] > 1 {
+			short[i] = name
+		}
+	}
+	return short
+}
+
 func shortenMiddle(s string, l int) string {
 	if len(s) > l {
 		l--
@@ -457,10 +3020,38 @@ func shortenMiddle(s string, l int) string {
 	return strings.ReplaceAll(s, "\n", "␤")
 }
 
+// hyperlinks makes idLink link IDs (--hyperlinks), when stdout is a terminal.
+var hyperlinks = false
+
+// idLink returns the shown part of id, as an OSC 8 hyperlink to
+// dx://examine/<id> with --hyperlinks. Terminals show the target on hover,
+// and can be set up to open it with dx examine.
+func idLink(id string) string {
+	if !hyperlinks || tableStyle.markdown || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return id[:idLength]
+	}
+	return "\x1b]8;;dx://examine/" + id + "\x1b\\" + id[:idLength] + "\x1b]8;;\x1b\\"
+}
+
+// idLength is how much of IDs ps and imgs show (--id-length).
+var idLength = 6
+
+func setIDLength(n int) {
+	// IDs are 64 hex digits; fewer than 4 is hardly an ID
+	if n < 4 || n > 64 {
+		fmt.Printf("%d: ID length must be 4-64.\n", n)
+		os.Exit(2)
+	}
+	idLength = n
+}
+
+// rawSizes makes prettySize give exact byte counts (--raw-size).
+var rawSizes = false
+
 func prettySize(bytes int64) string {
 	byts := float64(bytes)
 	unit := float64(1024)
-	if byts < unit {
+	if byts < unit || rawSizes {
 		return fmt.Sprintf("%d", bytes)
 	}
 	exp := math.Log(byts) / math.Log(unit)
@@ -468,3 +3059,60 @@ func prettySize(bytes int64) string {
 		byts/math.Pow(unit, math.Floor(exp)),
 		"kMGTPE"[int(exp)-1])
 }
+
+// parseSize is the counterpart of prettySize: it parses a byte count with an
+// optional unit, like 500MB, 1.5G or 2gb, in powers of 1024.
+func parseSize(s string) (int64, error) {
+	// Upper casing can change the length of non-ASCII, so only slice its
+	// result
+	upper := strings.ToUpper(s)
+	num := strings.TrimRight(upper, "BKMGTPE")
+	unit := strings.TrimSuffix(upper[len(num):], "B")
+	exp := 0
+	if unit != "" {
+		exp = strings.Index("KMGTPE", unit) + 1
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || n < 0 || len(unit) > 1 || unit != "" && exp == 0 {
+		return 0, fmt.Errorf("%q: not a size like 500MB", s)
+	}
+	return int64(n * math.Pow(1024, float64(exp))), nil
+}
+
+// sizeValue is a flag taking a size, like --min-size 500MB.
+type sizeValue int64
+
+func (v *sizeValue) String() string {
+	return strconv.FormatInt(int64(*v), 10)
+}
+
+func (v *sizeValue) Set(s string) error {
+	n, err := parseSize(s)
+	*v = sizeValue(n)
+	return err
+}
+
+func (v *sizeValue) Type() string {
+	return "size"
+}
+
+// durationValue is a flag taking a duration as parseDuration does, like
+// --until 2w.
+type durationValue time.Duration
+
+func (v *durationValue) String() string {
+	if *v == 0 {
+		return "0"
+	}
+	return time.Duration(*v).String()
+}
+
+func (v *durationValue) Set(s string) error {
+	d, err := parseDuration(s)
+	*v = durationValue(d)
+	return err
+}
+
+func (v *durationValue) Type() string {
+	return "duration"
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestSortRows(t *testing.T) {
+	created := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	rows := func() []psRow {
+		row := func(name string, project string, service string, imageAge time.Duration) psRow {
+			r := psRow{ID: name, Name: name, Project: project, Service: service, Created: created}
+			if imageAge > 0 {
+				r.ImageCreated = created.Add(-imageAge)
+			}
+			r.ImageAge, _ = age(r.ImageCreated)
+			created = created.Add(time.Minute)
+			return r
+		}
+		return []psRow{
+			row("web", "shop", "web", 3*time.Hour),
+			row("loner", "", "", 0),
+			row("db", "shop", "db", time.Hour),
+			row("cache", "blog", "cache", 0),
+			row("adhoc", "", "", 2*time.Hour),
+		}
+	}
+
+	tests := []struct {
+		key          string
+		missingFirst bool
+		want         []string
+	}{
+		{"created", false, []string{"web", "loner", "db", "cache", "adhoc"}},
+		{"created", true, []string{"web", "loner", "db", "cache", "adhoc"}},
+		{"name", false, []string{"adhoc", "cache", "db", "loner", "web"}},
+		{"project", false, []string{"cache", "db", "web", "adhoc", "loner"}},
+		{"project", true, []string{"adhoc", "loner", "cache", "db", "web"}},
+		{"image-age", false, []string{"db", "adhoc", "web", "loner", "cache"}},
+		{"image-age", true, []string{"loner", "cache", "db", "adhoc", "web"}},
+	}
+	for _, test := range tests {
+		r := rows()
+		sortRows(r, test.key, test.missingFirst)
+		got := []string{}
+		for _, row := range r {
+			got = append(got, row.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sortRows(%s, missingFirst=%v) = %v, want %v", test.key, test.missingFirst, got, test.want)
+		}
+	}
+}
+
+func TestPsMissing(t *testing.T) {
+	tests := []struct {
+		key  string
+		row  psRow
+		want bool
+	}{
+		{"project", psRow{Project: "shop"}, false},
+		{"project", psRow{}, true},
+		{"image-age", psRow{ImageCreated: time.Now()}, false},
+		{"image-age", psRow{}, true},
+	}
+	for _, test := range tests {
+		if got := psMissing[test.key](test.row); got != test.want {
+			t.Errorf("psMissing[%s](%+v) = %v, want %v", test.key, test.row, got, test.want)
+		}
+	}
+	for key := range psMissing {
+		if _, ok := psSorts[key]; !ok {
+			t.Errorf("psMissing has %s, which is not a sort key", key)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	started := time.Now().Add(-3*time.Hour - time.Minute)
+	finished := time.Now().Add(-2*time.Hour - time.Minute)
+	tests := []struct {
+		name   string
+		state  docker.State
+		want   string
+		failed bool
+	}{
+		{"removing", docker.State{RemovalInProgress: true, Dead: true}, "removing", false},
+		{"removing status", docker.State{Status: "removing", ExitCode: 1, FinishedAt: finished}, "removing", false},
+		{"dead", docker.State{Dead: true, StartedAt: started, FinishedAt: finished}, "dead", true},
+		{"created", docker.State{Status: "created"}, "created", false},
+		{"restarting", docker.State{Status: "restarting", Restarting: true, StartedAt: started}, "restarting", true},
+		{"killed", docker.State{Status: "exited", StartedAt: started}, "killed?", false},
+		{"stopping", docker.State{Status: "running", StartedAt: started}, "stopping", false},
+		{"exited", docker.State{Status: "exited", StartedAt: started, FinishedAt: finished}, "exit(0)2h", false},
+		{"exited non-zero", docker.State{Status: "exited", ExitCode: 137, StartedAt: started, FinishedAt: finished}, "exit(137)2h", true},
+		{"oom killed", docker.State{Status: "exited", OOMKilled: true, ExitCode: 137, StartedAt: started, FinishedAt: finished}, "exit(137)2h", true},
+		{"restart", docker.State{Status: "restarting", Running: true, Restarting: true, ExitCode: 1, StartedAt: started, FinishedAt: finished}, "restart(1)2h", true},
+		{"running", docker.State{Status: "running", Running: true, StartedAt: started}, "3h", false},
+		{"running after exit", docker.State{Status: "running", Running: true, ExitCode: 1, StartedAt: started, FinishedAt: finished}, "3h", false},
+		{"paused", docker.State{Status: "paused", Running: true, Paused: true, StartedAt: started}, "3hPaused", false},
+	}
+	for _, test := range tests {
+		if got := state(test.state); got != test.want {
+			t.Errorf("%s: state() = %q, want %q", test.name, got, test.want)
+		}
+		if got := failed(test.state); got != test.failed {
+			t.Errorf("%s: failed() = %v, want %v", test.name, got, test.failed)
+		}
+	}
+}
+
+func TestWriteTableRight(t *testing.T) {
+	var out bytes.Buffer
+	writeTableTo(&out, []column{
+		{key: "id", label: "id"},
+		{key: "size", label: "size", right: true},
+		{key: "repotags", label: "repotags"},
+	}, [][]string{
+		{"a1b2c3", "1.2GB", "big:latest"},
+		{"d4e5f6", "512", "tiny:latest"},
+		{"789abc", "88.5MB", ""},
+	})
+	want := `id       size repotags
+a1b2c3  1.2GB big:latest
+d4e5f6    512 tiny:latest
+789abc 88.5MB
+`
+	if out.String() != want {
+		t.Errorf("writeTable wrote\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestWriteTableRightColored(t *testing.T) {
+	// Escape codes take no room on the terminal, but the tabwriter counts
+	// them, so a colored cell must not shift the columns after it
+	var out bytes.Buffer
+	writeTableTo(&out, []column{
+		{key: "id", label: "id"},
+		{key: "size", label: "size", right: true},
+		{key: "source", label: "source"},
+	}, [][]string{
+		{green + "a1b2c3" + reset, "1.2GB", "registry"},
+		{plain + "d4e5f6" + reset, "512", "local"},
+	})
+	lines := strings.Split(strings.TrimSuffix(escapes.ReplaceAllString(out.String(), ""), "\n"), "\n")
+	want := []string{
+		"id      size source",
+		"a1b2c3 1.2GB registry",
+		"d4e5f6   512 local",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("writeTable wrote %q, want %q", lines, want)
+	}
+}
+
+func TestAlignRight(t *testing.T) {
+	got := alignRight([]string{"size", "1.2GB", "512", "→8"})
+	want := []string{" size", "1.2GB", "  512", "   →8"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("alignRight = %q, want %q", got, want)
+	}
+}
+
+func TestPrettyDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		short    string
+		long     string
+	}{
+		{0, "now", "now"},
+		{999 * time.Millisecond, "now", "now"},
+		{59*time.Second + 999*time.Millisecond, "59s", "59s"},
+		{60 * time.Second, "1m", "1m"},
+		{90 * time.Second, "1m", "1m30s"},
+		{59*time.Minute + 59*time.Second, "59m", "59m59s"},
+		{time.Hour, "1h", "1h"},
+		{time.Hour + 30*time.Second, "1h", "1h"},
+		{24 * time.Hour, "24h", "1d"},
+		{47 * time.Hour, "47h", "1d23h"},
+		{47*time.Hour + 59*time.Minute, "47h", "1d23h"},
+		{48 * time.Hour, "2d", "2d"},
+		{8 * 24 * time.Hour, "8d", "1w1d"},
+		{14 * 24 * time.Hour, "2w", "2w"},
+		{400 * 24 * time.Hour, "13M", "1y1M"},
+	}
+	defer func(long bool) { longAges = long }(longAges)
+	for _, test := range tests {
+		longAges = false
+		if got := prettyDuration(test.duration); got != test.short {
+			t.Errorf("prettyDuration(%s) = %q, want %q", test.duration, got, test.short)
+		}
+		longAges = true
+		if got := prettyDuration(test.duration); got != test.long {
+			t.Errorf("long prettyDuration(%s) = %q, want %q", test.duration, got, test.long)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"45", 45 * time.Second},
+		{"59s", 59 * time.Second},
+		{"1m", time.Minute},
+		{"1m30s", 90 * time.Second},
+		{"168h", 168 * time.Hour},
+		{"1d23h", 47 * time.Hour},
+		{"1.5h", 90 * time.Minute},
+		{"2w", 14 * 24 * time.Hour},
+		{"1y1M", 395 * 24 * time.Hour},
+	}
+	for _, test := range tests {
+		got, err := parseDuration(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("parseDuration(%q) = %s, %v, want %s", test.s, got, err, test.want)
+		}
+	}
+	for _, s := range []string{"", "h", "3x", "1h 2m", "-1h", "1h-"} {
+		if _, err := parseDuration(s); err == nil {
+			t.Errorf("parseDuration(%q) did not fail", s)
+		}
+	}
+	// What the long format prints parses back, if it lost nothing
+	for _, d := range []time.Duration{59 * time.Second, 90 * time.Second, 47 * time.Hour, 8 * 24 * time.Hour} {
+		if got, err := parseDuration(prettyDurationLong(d)); err != nil || got != d {
+			t.Errorf("parseDuration(prettyDurationLong(%s)) = %s, %v", d, got, err)
+		}
+	}
+}
+
+func TestShortenUnique(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{
+			[]string{"web", "some_long_database"},
+			[]string{"web", "some_long…"},
+		},
+		{
+			// Shortening at the end would lose what sets them apart
+			[]string{"myproject_worker_1", "myproject_worker_2", "other_long_name"},
+			[]string{"mypro…er_1", "mypro…er_2", "other_lon…"},
+		},
+		{
+			// Shortening in the middle too, so they stay whole
+			[]string{"longprefix_a_suffix", "longprefix_b_suffix", "short"},
+			[]string{"longprefix_a_suffix", "longprefix_b_suffix", "short"},
+		},
+	}
+	for _, test := range tests {
+		if got := shortenUnique(test.names, 10); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("shortenUnique(%q) = %q, want %q", test.names, got, test.want)
+		}
+	}
+}
+
+func TestIPs(t *testing.T) {
+	networks := docker.NetworkList{Networks: map[string]docker.ContainerNetwork{
+		"zeta":   {IPAddress: "172.20.0.2"},
+		"host":   {},
+		"bridge": {IPAddress: "172.17.0.5"},
+		"alpha":  {IPAddress: "172.19.0.3"},
+		"beta":   {IPAddress: ""},
+	}}
+	want := []string{"172.17.0.5", "172.19.0.3", "172.20.0.2"}
+	// Map order varies from run to run, so try a few times
+	for n := 0; n < 20; n++ {
+		if got := ips(networks); !reflect.DeepEqual(got, want) {
+			t.Fatalf("ips() = %q, want %q", got, want)
+		}
+	}
+	if got := ips(docker.NetworkList{}); len(got) != 0 {
+		t.Errorf("ips() of no networks = %q, want none", got)
+	}
+}
+
+func TestWriteTableMarks(t *testing.T) {
+	// Cells with more colors than others in their column, like the up of
+	// a container that is both oom killed and idle, must not shift what
+	// follows them
+	var out bytes.Buffer
+	writeTableTo(&out, []column{
+		{key: "up", label: "up"},
+		{key: "image", label: "image"},
+	}, [][]string{
+		{"exit(137)2h " + red + "oom" + reset + " " + yellow + "idle" + reset, "nginx"},
+		{"3h", "redis"},
+		{"3h " + yellow + "idle" + reset, "postgres"},
+		{"5m\x1b[1m", "busybox"},
+	})
+	lines := strings.Split(strings.TrimSuffix(escapes.ReplaceAllString(out.String(), ""), "\n"), "\n")
+	want := []string{
+		"up                   image",
+		"exit(137)2h oom idle nginx",
+		"3h                   redis",
+		"3h idle              postgres",
+		"5m                   busybox",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("writeTable wrote\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"1k", 1024},
+		{"1KB", 1024},
+		{"1.5G", 1536 * 1024 * 1024},
+		{"500mb", 500 * 1024 * 1024},
+		{"2b", 2},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", test.s, got, err, test.want)
+		}
+	}
+	for _, s := range []string{"", "MB", "1XB", "1MBB", "-1M", "ɐ", "1ɐ", "ſ"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("parseSize(%q) did not fail", s)
+		}
+	}
+}
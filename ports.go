@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// portBinding is a host port published by a running container.
+type portBinding struct {
+	public    int64
+	proto     string
+	ips       []string
+	container string
+	private   int64
+}
+
+// listPorts prints the published ports of running containers, by host port.
+// A host port published by more than one container (on different IPs) is
+// flagged, since which one answers depends on the address used.
+func listPorts() {
+	client := newClient()
+	containers, err := client.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		fatalf("ListContainers: %s", err)
+	}
+
+	bindings := []*portBinding{}
+	// IPv4 and IPv6 listeners of a binding are listed separately
+	seen := map[string]*portBinding{}
+	for i := range containers {
+		name := containerName(&containers[i])
+		for _, p := range containers[i].Ports {
+			if p.IP == "" {
+				continue // not published
+			}
+			key := fmt.Sprintf("%d/%s %s %d", p.PublicPort, p.Type, name, p.PrivatePort)
+			b, ok := seen[key]
+			if !ok {
+				b = &portBinding{public: p.PublicPort, proto: p.Type, container: name, private: p.PrivatePort}
+				seen[key] = b
+				bindings = append(bindings, b)
+			}
+			if !contains(b.ips, p.IP) {
+				b.ips = append(b.ips, p.IP)
+			}
+		}
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		a, b := bindings[i], bindings[j]
+		if a.public != b.public {
+			return a.public < b.public
+		}
+		if a.proto != b.proto {
+			return a.proto < b.proto
+		}
+		return a.container < b.container
+	})
+
+	users := map[string][]string{}
+	for _, b := range bindings {
+		key := fmt.Sprintf("%d/%s", b.public, b.proto)
+		if !contains(users[key], b.container) {
+			users[key] = append(users[key], b.container)
+		}
+	}
+
+	lines := [][]string{}
+	for _, b := range bindings {
+		key := fmt.Sprintf("%d/%s", b.public, b.proto)
+		conflict := ""
+		if len(users[key]) > 1 {
+			conflict = colorize("conflict", red)
+		}
+		lines = append(lines, []string{key, strings.Join(b.ips, ","), b.container,
+			strconv.FormatInt(b.private, 10), conflict})
+	}
+	writeTable([]column{
+		{key: "hostPort", label: "host port"},
+		{key: "ip", label: "ip"},
+		{key: "container", label: "container"},
+		{key: "port", label: "port"},
+		{key: "conflict", label: ""},
+	}, lines)
+}
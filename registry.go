@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// The key Docker Hub credentials are stored under in the docker config.
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+func pull(image string) {
+	client := newClient()
+	repo, tag := docker.ParseRepositoryTag(image)
+	if tag == "" {
+		tag = "latest"
+	}
+	err := client.PullImage(
+		docker.PullImageOptions{
+			Repository: repo, Tag: tag, OutputStream: os.Stdout,
+		}, registryAuth(registryOf(repo)))
+	if err != nil {
+		fatalf("PullImage: %s", err)
+	}
+}
+
+func search(term string) {
+	client := newClient()
+	results, err := client.SearchImagesEx(term, registryAuth(registryOf(term)))
+	if err != nil {
+		fatalf("SearchImages: %s", err)
+	}
+
+	lines := [][]string{}
+	for _, r := range results {
+		official := ""
+		if r.IsOfficial {
+			official = "yes"
+		}
+		lines = append(lines, []string{r.Name, strconv.Itoa(r.StarCount), official,
+			shorten(r.Description, int(0.5*float64(termwidth())))})
+	}
+	writeTable([]column{
+		{key: "name", label: "name"},
+		{key: "stars", label: "stars", right: true},
+		{key: "official", label: "official"},
+		{key: "description", label: "description"},
+	}, lines)
+}
+
+// registryOf returns the registry part of an image reference, following
+// docker's rule that the first path component is a registry only if it looks
+// like a hostname.
+func registryOf(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 &&
+		(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return dockerHubRegistry
+}
+
+// registryAuth resolves credentials for registry from the docker config
+// (~/.docker/config.json, or $DOCKER_CONFIG), asking any configured
+// credential helper (credsStore/credHelpers) first. If nothing is found, the
+// empty configuration is returned, meaning anonymous access.
+func registryAuth(registry string) docker.AuthConfiguration {
+	if auth, err := docker.NewAuthConfigurationsFromCredsHelpers(registry); err == nil {
+		return *auth
+	}
+	auths, err := docker.NewAuthConfigurationsFromDockerCfg()
+	if err != nil {
+		return docker.AuthConfiguration{}
+	}
+	for key, auth := range auths.Configs {
+		if registryHost(key) == registryHost(registry) {
+			return auth
+		}
+	}
+	return docker.AuthConfiguration{}
+}
+
+// registryHost strips scheme and path, so that "https://quay.io/v1/" and
+// "quay.io" compare equal.
+func registryHost(registry string) string {
+	if i := strings.Index(registry, "://"); i >= 0 {
+		registry = registry[i+3:]
+	}
+	return strings.SplitN(registry, "/", 2)[0]
+}
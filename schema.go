@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemaRows are the rows that ps, imgs, and vols output with --format json,
+// and the schema subcommand describes.
+var schemaRows = map[string]interface{}{
+	"ps":   psRow{},
+	"imgs": imgRow{},
+	"vols": volRow{},
+}
+
+// schema prints the JSON Schema of the --format json output of a listing
+// subcommand, made from the json tags of its row struct.
+func schema(sub string) {
+	row, ok := schemaRows[sub]
+	if !ok {
+		fmt.Printf("%q: expected ps, imgs, or vols.\n", sub)
+		os.Exit(2)
+	}
+	s := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "dx " + sub + " --format json",
+		"type":    "array",
+		"items":   typeSchema(reflect.TypeOf(row)),
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		fatalf("Marshal: %s", err)
+	}
+	fmt.Printf("%s\n", b)
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	}
+
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		if tag[0] == "-" || tag[0] == "" {
+			continue
+		}
+		properties[tag[0]] = typeSchema(t.Field(i).Type)
+		if !contains(tag[1:], "omitempty") {
+			required = append(required, tag[0])
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
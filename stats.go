@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"golang.org/x/term"
+)
+
+// stats prints a one-line resource summary of a container, or with --follow
+// keeps updating it in place until interrupted. With --repeat N, it prints
+// N samples, a line each.
+func stats(arg string, opts allOpts) {
+	client := newClient()
+	c, err := resolveContainer(client, arg)
+	if err != nil {
+		failf("%s", err)
+	}
+	fmt.Fprintf(os.Stderr, "Found container: %s %s\n", c.ID[:6], containerName(c))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	// Rewrite the line only when someone watches it
+	inPlace := opts.statsFollow && opts.statsRepeat == 0 && term.IsTerminal(int(os.Stdout.Fd()))
+	if err := streamStats(client, c.ID, opts, os.Stdout, inPlace, interrupt); err != nil {
+		fatalf("Stats: %s", err)
+	}
+}
+
+// streamStats prints stats samples of container id to out, until the
+// daemon ends the stream, --repeat samples are printed, or an interrupt
+// comes. Only the first is an error when stopping cuts the stream.
+func streamStats(client *docker.Client, id string, opts allOpts, out io.Writer, inPlace bool,
+	interrupt <-chan os.Signal) error {
+	samples := make(chan *docker.Stats)
+	done := make(chan bool)
+	var stop sync.Once
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Stats(docker.StatsOptions{
+			ID: id, Stats: samples, Stream: opts.statsFollow || opts.statsRepeat > 0, Done: done,
+		})
+	}()
+
+	go func() {
+		<-interrupt
+		stop.Do(func() { close(done) })
+	}()
+
+	printed := 0
+	for s := range samples {
+		if opts.statsRepeat > 0 && printed == opts.statsRepeat {
+			// Samples in flight until the stream stops
+			continue
+		}
+		if inPlace {
+			fmt.Fprintf(out, "\r\x1b[K%s", statsLine(s))
+		} else {
+			fmt.Fprintln(out, statsLine(s))
+		}
+		printed++
+		if printed == opts.statsRepeat {
+			stop.Do(func() { close(done) })
+		}
+	}
+	if inPlace && printed > 0 {
+		fmt.Fprintln(out)
+	}
+	err := <-errc
+	select {
+	case <-done:
+		// Stopping closes the stream under the client, which it reports
+		return nil
+	default:
+		return err
+	}
+}
+
+// statsLine summarizes a stats sample like docker stats does: CPU relative
+// to one core, memory without the reclaimable page cache.
+func statsLine(s *docker.Stats) string {
+	cpu := cpuPercent(s)
+
+	mem := s.MemoryStats.Usage
+	cache := s.MemoryStats.Stats.InactiveFile // cgroup v2
+	if cache == 0 {
+		cache = s.MemoryStats.Stats.TotalInactiveFile
+	}
+	if cache < mem {
+		mem -= cache
+	}
+
+	var rx, tx uint64
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	var read, write uint64
+	for _, e := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
+		}
+	}
+
+	return fmt.Sprintf("cpu %.1f%%  mem %s/%s  net %s/%s  block %s/%s",
+		cpu,
+		prettySize(int64(mem)), prettySize(int64(s.MemoryStats.Limit)),
+		prettySize(int64(rx)), prettySize(int64(tx)),
+		prettySize(int64(read)), prettySize(int64(write)))
+}
+
+// cpuPercent is the CPU usage in a stats sample, in percent of one core.
+func cpuPercent(s *docker.Stats) float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	sysDelta := float64(s.CPUStats.SystemCPUUsage) - float64(s.PreCPUStats.SystemCPUUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta <= 0 || sysDelta <= 0 {
+		return 0
+	}
+	return cpuDelta / sysDelta * cpus * 100
+}
+
+// sampleCPU takes one stats sample of a container, which takes the daemon
+// a second or so, and returns its CPU usage.
+func sampleCPU(client *docker.Client, id string) (float64, error) {
+	samples := make(chan *docker.Stats)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Stats(docker.StatsOptions{ID: id, Stats: samples, Stream: false})
+	}()
+	cpu := 0.0
+	for s := range samples {
+		cpu = cpuPercent(s)
+	}
+	return cpu, <-errc
+}
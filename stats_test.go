@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// statsServer is a daemon that streams a stats sample of any container
+// every few milliseconds, until the client goes away.
+func statsServer(t *testing.T) *docker.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/stats") {
+			http.NotFound(w, r)
+			return
+		}
+		enc := json.NewEncoder(w)
+		for {
+			sample := docker.Stats{}
+			sample.MemoryStats.Usage = 1024 * 1024
+			sample.MemoryStats.Limit = 1024 * 1024 * 1024
+			if err := enc.Encode(sample); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			if r.URL.Query().Get("stream") != "true" {
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestStreamStatsRepeat(t *testing.T) {
+	client := statsServer(t)
+	var out bytes.Buffer
+	err := streamStats(client, "web", allOpts{statsRepeat: 3}, &out, false, make(chan os.Signal))
+	if err != nil {
+		t.Fatalf("streamStats: %s", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "cpu 0.0%  mem 1.0MB/1.0GB") {
+		t.Errorf("streamStats printed %q, want 3 samples", lines)
+	}
+}
+
+func TestStreamStatsOnce(t *testing.T) {
+	client := statsServer(t)
+	var out bytes.Buffer
+	if err := streamStats(client, "web", allOpts{}, &out, false, make(chan os.Signal)); err != nil {
+		t.Fatalf("streamStats: %s", err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 1 {
+		t.Errorf("streamStats printed %d lines, want 1", n)
+	}
+}
+
+func TestStreamStatsInterrupt(t *testing.T) {
+	client := statsServer(t)
+	interrupt := make(chan os.Signal, 1)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		interrupt <- os.Interrupt
+	}()
+	var out bytes.Buffer
+	if err := streamStats(client, "web", allOpts{statsFollow: true}, &out, true, interrupt); err != nil {
+		t.Fatalf("streamStats: %s", err)
+	}
+	if !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("streamStats left the line unfinished: %q", out.String())
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// whereFields are the fields of a ps row that --where can test, by their
+// json names, except that state is docker's, like running or exited. Values
+// are strings, int64s (ages in seconds, sizes in bytes), or bools.
+var whereFields = map[string]func(row psRow) interface{}{
+	"host":          func(row psRow) interface{} { return row.Host },
+	"id":            func(row psRow) interface{} { return row.ID },
+	"name":          func(row psRow) interface{} { return row.Name },
+	"hostname":      func(row psRow) interface{} { return row.Hostname },
+	"project":       func(row psRow) interface{} { return row.Project },
+	"service":       func(row psRow) interface{} { return row.Service },
+	"age":           func(row psRow) interface{} { return row.Age },
+	"state":         func(row psRow) interface{} { return row.Status },
+	"health":        func(row psRow) interface{} { return row.Health },
+	"oomKilled":     func(row psRow) interface{} { return row.OOMKilled },
+	"failed":        func(row psRow) interface{} { return row.Failed },
+	"restartPolicy": func(row psRow) interface{} { return row.Restart },
+	"restartCount":  func(row psRow) interface{} { return int64(row.Restarts) },
+	"ip":            func(row psRow) interface{} { return strings.Join(row.IPs, ",") },
+	"networkMode":   func(row psRow) interface{} { return row.NetworkMode },
+	"ports":         func(row psRow) interface{} { return row.Ports },
+	"command":       func(row psRow) interface{} { return row.Command },
+	"logSize":       func(row psRow) interface{} { return row.LogSize },
+	"image":         func(row psRow) interface{} { return row.Image },
+	"imageAge":      func(row psRow) interface{} { return row.ImageAge },
+}
+
+// parseWhere parses a --where expression, like
+//
+//	state==running && age>1d && image~nginx
+//
+// into a test of a ps row. Comparisons are field op value, with op one of
+// == != < <= > >= and ~ (regular expression match, so also substring). They
+// combine with && and ||, which binds looser, and parentheses. Values with
+// spaces or operator characters are quoted with ' or ".
+func parseWhere(expr string) (func(row psRow) bool, error) {
+	tokens, err := whereTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &whereParser{tokens: tokens}
+	test, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return test, nil
+}
+
+var whereOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "~", "(", ")"}
+
+// whereTokens splits expr into operators, words, and quoted strings (kept
+// with their opening quote, to tell them from operators).
+func whereTokens(expr string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(expr); {
+		if expr[i] == ' ' || expr[i] == '\t' {
+			i++
+			continue
+		}
+		if q := expr[i]; q == '\'' || q == '"' {
+			end := strings.IndexByte(expr[i+1:], q)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c", q)
+			}
+			tokens = append(tokens, expr[i:i+1+end])
+			i += end + 2
+			continue
+		}
+		op := ""
+		for _, o := range whereOps {
+			if strings.HasPrefix(expr[i:], o) {
+				op = o
+				break
+			}
+		}
+		if op != "" {
+			tokens = append(tokens, op)
+			i += len(op)
+			continue
+		}
+		start := i
+		for i < len(expr) && !strings.ContainsRune(" \t'\"&|=!<>~()", rune(expr[i])) {
+			i++
+		}
+		if i == start {
+			return nil, fmt.Errorf("unexpected %q", expr[i:i+1])
+		}
+		tokens = append(tokens, expr[start:i])
+	}
+	return tokens, nil
+}
+
+type whereParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *whereParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+func (p *whereParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *whereParser) or() (func(row psRow) bool, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row psRow) bool { return l(row) || right(row) }
+	}
+	return left, nil
+}
+
+func (p *whereParser) and() (func(row psRow) bool, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row psRow) bool { return l(row) && right(row) }
+	}
+	return left, nil
+}
+
+func (p *whereParser) comparison() (func(row psRow) bool, error) {
+	field := p.next()
+	if field == "(" {
+		test, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return test, nil
+	}
+	get, ok := whereFields[field]
+	if !ok {
+		if field == "" {
+			return nil, fmt.Errorf("expected a field at the end")
+		}
+		return nil, fmt.Errorf("%q: unknown field", field)
+	}
+	op := p.next()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "~":
+	default:
+		return nil, fmt.Errorf("expected an operator after %s", field)
+	}
+	value := p.next()
+	if value == "" || contains(whereOps, value) {
+		return nil, fmt.Errorf("expected a value after %s%s", field, op)
+	}
+	if value[0] == '\'' || value[0] == '"' {
+		value = value[1:]
+	}
+
+	if op == "~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(row psRow) bool {
+			return re.MatchString(fmt.Sprint(get(row)))
+		}, nil
+	}
+	switch get(psRow{}).(type) {
+	case int64:
+		n, err := whereNumber(field, value)
+		if err != nil {
+			return nil, err
+		}
+		return func(row psRow) bool {
+			return compare(op, get(row).(int64), n)
+		}, nil
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil || op != "==" && op != "!=" {
+			return nil, fmt.Errorf("%s is true or false, compared with == or !=", field)
+		}
+		return func(row psRow) bool {
+			return (get(row).(bool) == b) == (op == "==")
+		}, nil
+	}
+	if op != "==" && op != "!=" {
+		return nil, fmt.Errorf("%s is compared with ==, !=, or ~", field)
+	}
+	return func(row psRow) bool {
+		return (get(row).(string) == value) == (op == "==")
+	}, nil
+}
+
+// whereNumber parses the value of a numeric field: a count, a size like
+// 10MB, or an age like 90s, 3h, or 2d.
+func whereNumber(field string, value string) (int64, error) {
+	if strings.HasSuffix(field, "Count") {
+		return strconv.ParseInt(value, 10, 64)
+	}
+	if strings.HasSuffix(field, "Size") {
+		return parseSize(value)
+	}
+	d, err := parseDuration(value)
+	return int64(d.Seconds()), err
+}
+
+func compare(op string, a int64, b int64) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}